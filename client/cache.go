@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultCacheSize     = 4096
+	DefaultFinalityDepth = 64
+	// DefaultFlightTimeout 合并后的请求的超时
+	DefaultFlightTimeout = 30 * time.Second
+)
+
+// defaultImmutableSelectors 结果不会变化的合约方法: decimals() symbol() name()
+var defaultImmutableSelectors = []string{"0x313ce567", "0x95d89b41", "0x06fdde03"}
+
+// CacheStats 缓存命中统计
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Shared    uint64
+	Evictions uint64
+	Entries   int
+}
+
+type CacheOpt func(c *CachedProvider)
+
+// WithCacheSize 最多缓存的结果数
+func WithCacheSize(size int) CacheOpt {
+	return func(c *CachedProvider) {
+		c.cache = newLRU(size)
+	}
+}
+
+// WithFinalityDepth 落后最新高度超过depth的区块视为不可变
+func WithFinalityDepth(depth uint64) CacheOpt {
+	return func(c *CachedProvider) {
+		c.finalityDepth = depth
+	}
+}
+
+// WithImmutableSelectors 结果可以缓存的合约方法selector，如 0x313ce567
+func WithImmutableSelectors(selectors ...string) CacheOpt {
+	return func(c *CachedProvider) {
+		c.selectors = make(map[string]bool, len(selectors))
+		for _, selector := range selectors {
+			c.selectors[strings.ToLower(selector)] = true
+		}
+	}
+}
+
+// CachedProvider 合并相同的并发请求，并缓存不可变的结果(按hash查询的区块、chain id、已确认的区块等)
+// 返回的区块、交易是缓存的副本，调用方可以修改，如追加 InternalTraceCalls
+type CachedProvider struct {
+	Provider
+	cache         *lru
+	flights       flightGroup
+	finalityDepth uint64
+	selectors     map[string]bool
+	head          uint64
+	metricsName   string
+
+	hits   uint64
+	misses uint64
+	shared uint64
+}
+
+func NewCachedProvider(provider Provider, opts ...CacheOpt) *CachedProvider {
+	c := &CachedProvider{Provider: provider, cache: newLRU(DefaultCacheSize), finalityDepth: DefaultFinalityDepth}
+	WithImmutableSelectors(defaultImmutableSelectors...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Stats 缓存命中统计
+func (c *CachedProvider) Stats() CacheStats {
+	c.cache.mu.Lock()
+	evictions := c.cache.evictions
+	c.cache.mu.Unlock()
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Shared:    atomic.LoadUint64(&c.shared),
+		Evictions: evictions,
+		Entries:   c.cache.len(),
+	}
+}
+
+// load 优先读取缓存，否则合并并发请求，cacheable 判断结果是否可以缓存
+// 合并后的请求使用与调用方ctx分离的上下文，超时为 DefaultFlightTimeout，调用方取消只影响自己
+func (c *CachedProvider) load(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error), cacheable func(v interface{}) bool) (interface{}, error) {
+	if v, ok := c.cache.get(key); ok {
+		atomic.AddUint64(&c.hits, 1)
+		c.observe("hit")
+		return v, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	c.observe("miss")
+	v, err, shared := c.flights.do(ctx, key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(detachedContext{ctx}, DefaultFlightTimeout)
+		defer cancel()
+		v, err := fetch(fetchCtx)
+		if err == nil && cacheable != nil && cacheable(v) {
+			evicted, entries := c.cache.add(key, v)
+			c.observeEntries(evicted, entries)
+		}
+		return v, err
+	})
+	if shared {
+		atomic.AddUint64(&c.shared, 1)
+		c.observe("shared")
+	}
+	return v, err
+}
+
+// detachedContext 保留ctx中的值(如trace)，但不继承取消及超时
+type detachedContext struct {
+	parent context.Context
+}
+
+func (d detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (d detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// finalized 区块高度是否已经不可逆
+func (c *CachedProvider) finalized(height uint64) bool {
+	head := atomic.LoadUint64(&c.head)
+	return head > 0 && height+c.finalityDepth <= head
+}
+
+// ensureHead 尚未获取过最新高度时查询一次，失败时只是不缓存区块
+func (c *CachedProvider) ensureHead(ctx context.Context) {
+	if atomic.LoadUint64(&c.head) == 0 {
+		_, _ = c.BlockNumber(ctx)
+	}
+}
+
+func (c *CachedProvider) observeHead(head uint64) {
+	for {
+		old := atomic.LoadUint64(&c.head)
+		if head <= old || atomic.CompareAndSwapUint64(&c.head, old, head) {
+			return
+		}
+	}
+}
+
+func always(interface{}) bool {
+	return true
+}
+
+// ChainID 链ID不会变化，始终缓存
+func (c *CachedProvider) ChainID(ctx context.Context) (*big.Int, error) {
+	v, err := c.load(ctx, "chainId", func(ctx context.Context) (interface{}, error) {
+		return c.Provider.ChainID(ctx)
+	}, always)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Set(v.(*big.Int)), nil
+}
+
+// BlockNumber 只合并并发请求，同时记录最新高度用于判断区块是否已确认
+func (c *CachedProvider) BlockNumber(ctx context.Context) (uint64, error) {
+	v, err := c.load(ctx, "blockNumber", func(ctx context.Context) (interface{}, error) {
+		return c.Provider.BlockNumber(ctx)
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	c.observeHead(v.(uint64))
+	return v.(uint64), nil
+}
+
+// BlockByHash 区块hash对应的内容不会变化，只缓存hash一致的结果，节点返回null(未知或尚未同步的区块)时返回 errs.BlockNotFound
+func (c *CachedProvider) BlockByHash(ctx context.Context, hash block.Hash, full bool) (*block.Block, error) {
+	v, err := c.load(ctx, fmt.Sprintf("blockByHash:%s:%t", hash, full), func(ctx context.Context) (interface{}, error) {
+		return c.Provider.BlockByHash(ctx, hash, full)
+	}, func(v interface{}) bool {
+		return v.(*block.Block).Hash == hash
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := v.(*block.Block)
+	if b.Hash == (block.Hash{}) {
+		return nil, errs.New(errs.BlockNotFound, fmt.Sprintf("block %s", hash))
+	}
+	return b.Copy(), nil
+}
+
+// BlockByNumber 只缓存已确认的区块
+// 最新高度来自经过缓存的 BlockNumber 及返回的区块，尚未获取过最新高度时会先查询一次
+func (c *CachedProvider) BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error) {
+	c.ensureHead(ctx)
+	v, err := c.load(ctx, fmt.Sprintf("blockByNumber:%d:%t", height, full), func(ctx context.Context) (interface{}, error) {
+		b, err := c.Provider.BlockByNumber(ctx, height, full)
+		if err == nil && b.Hash != (block.Hash{}) {
+			c.observeHead(uint64(b.Number))
+		}
+		return b, err
+	}, func(v interface{}) bool {
+		return v.(*block.Block).Hash != block.Hash{} && c.finalized(height)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*block.Block).Copy(), nil
+}
+
+// TransactionByHash 只缓存已被确认区块打包的交易
+func (c *CachedProvider) TransactionByHash(ctx context.Context, hash block.Hash, full bool) (*block.Transaction, error) {
+	c.ensureHead(ctx)
+	v, err := c.load(ctx, fmt.Sprintf("tx:%s:%t", hash, full), func(ctx context.Context) (interface{}, error) {
+		return c.Provider.TransactionByHash(ctx, hash, full)
+	}, func(v interface{}) bool {
+		tx := v.(*block.Transaction)
+		return tx.BlockHash != block.Hash{} && c.finalized(uint64(tx.BlockNumber))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*block.Transaction).Copy(), nil
+}
+
+// MethodCall 只缓存结果不会变化的合约方法，如 decimals()
+func (c *CachedProvider) MethodCall(ctx context.Context, out interface{}, args ...interface{}) error {
+	key, ok := c.immutableCallKey(args...)
+	if !ok || reflect.TypeOf(out).Kind() != reflect.Ptr {
+		return c.Provider.MethodCall(ctx, out, args...)
+	}
+	outType := reflect.TypeOf(out)
+	v, err := c.load(ctx, key, func(ctx context.Context) (interface{}, error) {
+		// 每个请求使用各自的out，合并的请求不能写入发起方的out
+		result := reflect.New(outType.Elem()).Interface()
+		if err := c.Provider.MethodCall(ctx, result, args...); err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+	}, always)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(v.([]byte), out)
+}
+
+// immutableCallKey 根据调用的合约地址及calldata生成缓存key
+func (c *CachedProvider) immutableCallKey(args ...interface{}) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	raw, err := json.Marshal(args[0])
+	if err != nil {
+		return "", false
+	}
+	var call struct {
+		To   string `json:"to"`
+		Data string `json:"data"`
+	}
+	if err = json.Unmarshal(raw, &call); err != nil || len(call.Data) < 10 {
+		return "", false
+	}
+	if !c.selectors[strings.ToLower(call.Data[:10])] {
+		return "", false
+	}
+	return fmt.Sprintf("call:%s:%s", strings.ToLower(call.To), strings.ToLower(call.Data)), true
+}
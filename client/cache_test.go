@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/metrics"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	Provider
+	calls uint64
+	head  uint64
+}
+
+func (p *countingProvider) ChainID(ctx context.Context) (*big.Int, error) {
+	atomic.AddUint64(&p.calls, 1)
+	time.Sleep(10 * time.Millisecond)
+	return big.NewInt(1), nil
+}
+
+func (p *countingProvider) BlockNumber(ctx context.Context) (uint64, error) {
+	atomic.AddUint64(&p.calls, 1)
+	return p.head, nil
+}
+
+func (p *countingProvider) BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error) {
+	atomic.AddUint64(&p.calls, 1)
+	return &block.Block{Number: math.HexOrDecimal64(height), Hash: block.Hash(common.BigToHash(new(big.Int).SetUint64(height + 1)))}, nil
+}
+
+// BlockByHash 只认识高度为1的区块，其他hash返回null
+func (p *countingProvider) BlockByHash(ctx context.Context, hash block.Hash, full bool) (*block.Block, error) {
+	atomic.AddUint64(&p.calls, 1)
+	if hash == block.Hash(common.BigToHash(big.NewInt(2))) {
+		return &block.Block{Number: 1, Hash: hash}, nil
+	}
+	return &block.Block{}, nil
+}
+
+func (p *countingProvider) MethodCall(ctx context.Context, out interface{}, args ...interface{}) error {
+	atomic.AddUint64(&p.calls, 1)
+	*out.(*string) = "0x12"
+	return nil
+}
+
+func TestCachedProvider(t *testing.T) {
+	ctx := context.Background()
+	p := &countingProvider{head: 100}
+	c := NewCachedProvider(p, WithCacheSize(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := c.ChainID(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), id.Int64())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&p.calls))
+
+	_, err := c.BlockNumber(ctx)
+	assert.Nil(t, err)
+	_, _ = c.BlockByNumber(ctx, 99, false)
+	_, _ = c.BlockByNumber(ctx, 99, false)
+	assert.Equal(t, uint64(4), atomic.LoadUint64(&p.calls), "unfinalized blocks are not cached")
+	_, _ = c.BlockByNumber(ctx, 10, false)
+	_, _ = c.BlockByNumber(ctx, 10, false)
+	assert.Equal(t, uint64(5), atomic.LoadUint64(&p.calls))
+
+	to := common.HexToAddress("0x1")
+	call := CallParameter{To: &to, Data: hexutil.MustDecode("0x313ce567")}.ToArg()
+	for i := 0; i < 2; i++ {
+		var decimals string
+		assert.Nil(t, c.MethodCall(ctx, &decimals, call, "latest"))
+		assert.Equal(t, "0x12", decimals)
+	}
+	assert.Equal(t, uint64(6), atomic.LoadUint64(&p.calls))
+
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, uint64(11), stats.Hits+stats.Shared)
+}
+
+func TestCachedProvider_metrics(t *testing.T) {
+	m := metrics.NewMemory()
+	metrics.SetBackend(m)
+	defer metrics.SetBackend(nil)
+	ctx := context.Background()
+	c := NewCachedProvider(&countingProvider{head: 100}, WithCacheSize(1), WithCacheMetrics(`test "cache"`))
+	for i := 0; i < 2; i++ {
+		_, err := c.ChainID(ctx)
+		assert.Nil(t, err)
+	}
+	_, err := c.BlockByNumber(ctx, 10, false)
+	assert.Nil(t, err)
+
+	assert.Equal(t, float64(1), m.Value(cacheRequests.Name(), `test "cache"`, "hit"))
+	assert.Equal(t, float64(3), m.Value(cacheRequests.Name(), `test "cache"`, "miss"))
+	assert.Equal(t, float64(1), m.Value(cacheEntries.Name(), `test "cache"`))
+	assert.Equal(t, float64(1), m.Value(cacheEvictions.Name(), `test "cache"`))
+}
+
+func TestCachedProvider_blockByHash(t *testing.T) {
+	ctx := context.Background()
+	p := &countingProvider{head: 100}
+	c := NewCachedProvider(p)
+
+	unknown := block.Hash(common.BigToHash(big.NewInt(100)))
+	for i := 0; i < 2; i++ {
+		_, err := c.BlockByHash(ctx, unknown, false)
+		assert.ErrorIs(t, err, errs.BlockNotFound)
+	}
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&p.calls), "null results are not cached")
+
+	known := block.Hash(common.BigToHash(big.NewInt(2)))
+	for i := 0; i < 2; i++ {
+		b, err := c.BlockByHash(ctx, known, false)
+		assert.Nil(t, err)
+		assert.Equal(t, known, b.Hash)
+	}
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&p.calls))
+}
+
+func TestCachedProvider_head(t *testing.T) {
+	ctx := context.Background()
+	p := &countingProvider{head: 100}
+	c := NewCachedProvider(p)
+
+	// 没有通过缓存调用过 BlockNumber 时先查询一次最新高度
+	for i := 0; i < 2; i++ {
+		_, err := c.BlockByNumber(ctx, 10, false)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&p.calls))
+	_, err := c.BlockByNumber(ctx, 99, false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&p.calls))
+}
+
+type blockingProvider struct {
+	Provider
+	release chan struct{}
+}
+
+func (p *blockingProvider) ChainID(ctx context.Context) (*big.Int, error) {
+	select {
+	case <-p.release:
+		return big.NewInt(1), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestCachedProvider_cancel(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	c := NewCachedProvider(p)
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := c.ChainID(leaderCtx)
+		leaderErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	followerErr := make(chan error, 1)
+	go func() {
+		_, err := c.ChainID(context.Background())
+		followerErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+	close(p.release)
+	assert.Nil(t, <-followerErr, "leader cancel must not fail followers")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c2 := NewCachedProvider(&blockingProvider{release: make(chan struct{})})
+	_, err := c2.ChainID(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCachedProvider_copy(t *testing.T) {
+	ctx := context.Background()
+	p := &countingProvider{head: 100}
+	c := NewCachedProvider(p)
+	_, err := c.BlockNumber(ctx)
+	assert.Nil(t, err)
+
+	b, err := c.BlockByNumber(ctx, 10, true)
+	assert.Nil(t, err)
+	b.Transactions = append(b.Transactions, &block.Transaction{InternalTraceCalls: []*block.InternalTxCallTrace{{}}})
+	calls := atomic.LoadUint64(&p.calls)
+
+	b, err = c.BlockByNumber(ctx, 10, true)
+	assert.Nil(t, err)
+	assert.Empty(t, b.Transactions, "mutating a returned block must not change the cache")
+	assert.Equal(t, calls, atomic.LoadUint64(&p.calls))
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Chain 链的元数据，polling 及 wallet 以此作为默认配置
+type Chain struct {
+	ID   uint64
+	Name string
+	// NativeSymbol 原生币符号
+	NativeSymbol string
+	// NativeDecimals 原生币精度
+	NativeDecimals int
+	// BlockTime 平均出块时间
+	BlockTime time.Duration
+	// FinalityDepth 超过该确认数的区块不会再被回滚
+	FinalityDepth uint64
+	// EIP1559 是否支持动态手续费交易
+	EIP1559 bool
+	// TraceType 获取内部交易时使用的trace方式
+	TraceType EthClientType
+}
+
+var chains = struct {
+	mu sync.RWMutex
+	m  map[uint64]Chain
+}{m: make(map[uint64]Chain)}
+
+func init() {
+	for _, chain := range []Chain{
+		{ID: 1, Name: "ethereum", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: 12 * time.Second, FinalityDepth: 64, EIP1559: true, TraceType: GethType},
+		{ID: 5, Name: "goerli", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: 12 * time.Second, FinalityDepth: 64, EIP1559: true, TraceType: GethType},
+		{ID: 11155111, Name: "sepolia", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: 12 * time.Second, FinalityDepth: 64, EIP1559: true, TraceType: GethType},
+		{ID: 10, Name: "optimism", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: 2 * time.Second, FinalityDepth: 64, EIP1559: true, TraceType: GethType},
+		{ID: 56, Name: "bsc", NativeSymbol: "BNB", NativeDecimals: 18, BlockTime: 3 * time.Second, FinalityDepth: 15, EIP1559: false, TraceType: GethType},
+		{ID: 97, Name: "bsc-testnet", NativeSymbol: "tBNB", NativeDecimals: 18, BlockTime: 3 * time.Second, FinalityDepth: 15, EIP1559: false, TraceType: GethType},
+		{ID: 137, Name: "polygon", NativeSymbol: "MATIC", NativeDecimals: 18, BlockTime: 2 * time.Second, FinalityDepth: 128, EIP1559: true, TraceType: ErigonType},
+		{ID: 250, Name: "fantom", NativeSymbol: "FTM", NativeDecimals: 18, BlockTime: time.Second, FinalityDepth: 1, EIP1559: false, TraceType: GethType},
+		{ID: 8453, Name: "base", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: 2 * time.Second, FinalityDepth: 64, EIP1559: true, TraceType: GethType},
+		{ID: 42161, Name: "arbitrum", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: 250 * time.Millisecond, FinalityDepth: 64, EIP1559: true, TraceType: GethType},
+		{ID: 43114, Name: "avalanche", NativeSymbol: "AVAX", NativeDecimals: 18, BlockTime: 2 * time.Second, FinalityDepth: 1, EIP1559: true, TraceType: GethType},
+		{ID: 1337, Name: "dev", NativeSymbol: "ETH", NativeDecimals: 18, BlockTime: time.Second, FinalityDepth: 0, EIP1559: true, TraceType: GethType},
+	} {
+		RegisterChain(chain)
+	}
+}
+
+// RegisterChain 注册或覆盖链的元数据
+func RegisterChain(chain Chain) {
+	chains.mu.Lock()
+	chains.m[chain.ID] = chain
+	chains.mu.Unlock()
+}
+
+// UnregisterChain 删除链的元数据，之后按 DefaultChain 处理
+func UnregisterChain(id uint64) {
+	chains.mu.Lock()
+	delete(chains.m, id)
+	chains.mu.Unlock()
+}
+
+// LookupChain 按链id查找已注册的元数据
+func LookupChain(id uint64) (Chain, bool) {
+	chains.mu.RLock()
+	defer chains.mu.RUnlock()
+	chain, ok := chains.m[id]
+	return chain, ok
+}
+
+// DefaultChain 未注册的链使用以太坊主网的参数，但默认使用legacy交易
+func DefaultChain(id uint64) Chain {
+	return Chain{
+		ID:             id,
+		Name:           fmt.Sprintf("chain-%d", id),
+		NativeSymbol:   "ETH",
+		NativeDecimals: 18,
+		BlockTime:      12 * time.Second,
+		FinalityDepth:  DefaultFinalityDepth,
+		EIP1559:        false,
+		TraceType:      GethType,
+	}
+}
+
+// ChainOf 查询节点的链id并返回对应的元数据
+// 未注册的链返回 DefaultChain，最新区块包含 baseFeePerGas 时认为支持EIP-1559
+func ChainOf(ctx context.Context, provider Provider) (Chain, error) {
+	id, err := provider.ChainID(ctx)
+	if err != nil {
+		return Chain{}, err
+	}
+	if chain, ok := LookupChain(id.Uint64()); ok {
+		return chain, nil
+	}
+	chain := DefaultChain(id.Uint64())
+	head, err := provider.BlockNumber(ctx)
+	if err != nil {
+		return Chain{}, err
+	}
+	latest, err := provider.BlockByNumber(ctx, head, false)
+	if err != nil {
+		return Chain{}, err
+	}
+	chain.EIP1559 = latest.BaseFeePerGas != nil
+	return chain, nil
+}
@@ -3,9 +3,12 @@ package client
 import (
 	"context"
 	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
 	"github.com/taorzhang/toolkit/types/block"
 	"math/big"
 	"strings"
@@ -21,42 +24,70 @@ const (
 type Eth struct {
 	client           *jsonrpc.Client
 	internalTxClient *jsonrpc.Client
+	ws               *transport.Ws
+	// chainID 期望的链id，ChainID 返回的链id不一致时报错
+	chainID uint64
+	// logRange FilterLogs 单次请求的最大区块数，0表示不限制
+	logRange uint64
+	// logConcurrency FilterLogs 同时查询的子范围数
+	logConcurrency int
 }
 
-func NewEthClient(client *jsonrpc.Client, internalTxClient *jsonrpc.Client) Provider {
-	return &Eth{client: client, internalTxClient: internalTxClient}
+type EthOpt func(e *Eth)
+
+// WithWs 订阅使用的websocket连接
+func WithWs(ws *transport.Ws) EthOpt {
+	return func(e *Eth) {
+		e.ws = ws
+	}
+}
+
+// WithChainID 期望的链id，节点返回的链id不一致时 ChainID 返回 errs.ChainIDMismatch，签名交易前即可发现
+// 创建节点连接时校验使用 jsonrpc.WithChainID
+func WithChainID(id uint64) EthOpt {
+	return func(e *Eth) {
+		e.chainID = id
+	}
+}
+
+// WithLogQuery FilterLogs 单次请求的最大区块数及同时查询的子范围数，maxRange为0时先查询整个范围，节点拒绝后再拆分
+func WithLogQuery(maxRange uint64, concurrency int) EthOpt {
+	return func(e *Eth) {
+		e.logRange = maxRange
+		e.logConcurrency = concurrency
+	}
+}
+
+// NewEthClient internalTxClient 用于trace请求，也可以与client相同，通过 jsonrpc.WithRoutes 将trace请求路由到trace节点
+func NewEthClient(client *jsonrpc.Client, internalTxClient *jsonrpc.Client, opts ...EthOpt) Provider {
+	e := &Eth{client: client, internalTxClient: internalTxClient, logConcurrency: DefaultLogConcurrency}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
 // BlockNumber 获取最新区块高度
 func (e *Eth) BlockNumber(ctx context.Context) (uint64, error) {
 	var number math.HexOrDecimal64
-	err := e.client.Call("eth_blockNumber", &number)
+	err := e.client.CallContext(ctx, "eth_blockNumber", &number)
 	return uint64(number), err
 }
 
 // MethodCall 执行一个eth call
 func (e *Eth) MethodCall(ctx context.Context, out interface{}, args ...interface{}) error {
-	return e.client.Call("eth_call", &out, args...)
+	return e.client.CallContext(ctx, "eth_call", &out, args...)
 }
 
 // BlockByHash 根据区块hash获取整个区块信息
 func (e *Eth) BlockByHash(ctx context.Context, hash block.Hash, full bool) (*block.Block, error) {
 	var blockData block.Block
-	err := e.client.Call("eth_getBlockByHash", &blockData, hash, full)
+	err := e.client.CallContext(ctx, "eth_getBlockByHash", &blockData, hash, full)
 	if err != nil {
 		return nil, err
 	}
 	if full {
-		var batch []rpc.BatchElem
-		for idx := range blockData.Transactions {
-			blockData.Transactions[idx].Receipt = new(block.Receipt)
-			batch = append(batch, rpc.BatchElem{
-				Method: "eth_getTransactionReceipt",
-				Args:   []interface{}{blockData.Transactions[idx].Hash},
-				Result: blockData.Transactions[idx].Receipt,
-			})
-		}
-		err = e.client.BatchCall(batch, true)
+		err = e.fillReceipts(ctx, []*block.Block{&blockData})
 	}
 	return &blockData, err
 }
@@ -64,7 +95,7 @@ func (e *Eth) BlockByHash(ctx context.Context, hash block.Hash, full bool) (*blo
 // GetNonce 获取账户的交易nonce
 func (e *Eth) GetNonce(ctx context.Context, addr block.Address, status string) (nonce uint64, err error) {
 	var result string
-	err = e.client.Call("eth_getTransactionCount", &result, addr.String(), status)
+	err = e.client.CallContext(ctx, "eth_getTransactionCount", &result, addr.String(), status)
 	if err != nil {
 		return
 	}
@@ -81,14 +112,23 @@ func (e *Eth) GetNonce(ctx context.Context, addr block.Address, status string) (
 
 // SendTx 发送一笔交易
 func (e *Eth) SendTx(ctx context.Context, signTx string) (result string, err error) {
-	err = e.client.Call("eth_sendRawTransaction", &result, signTx)
+	err = e.client.CallContext(ctx, "eth_sendRawTransaction", &result, signTx)
 	return
 }
 
 // BalanceAt 查询eth余额
 func (e *Eth) BalanceAt(ctx context.Context, address block.Address) (*big.Int, error) {
+	return e.balanceAt(ctx, address, "latest")
+}
+
+// BalanceAtHeight 指定高度的余额，历史高度需要归档节点
+func (e *Eth) BalanceAtHeight(ctx context.Context, address block.Address, height uint64) (*big.Int, error) {
+	return e.balanceAt(ctx, address, hexutil.Uint64(height))
+}
+
+func (e *Eth) balanceAt(ctx context.Context, address block.Address, blockArg interface{}) (*big.Int, error) {
 	var result string
-	err := e.client.Call("eth_getBalance", &result, address.String(), "latest")
+	err := e.client.CallContext(ctx, "eth_getBalance", &result, address.String(), blockArg)
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +143,7 @@ func (e *Eth) BalanceAt(ctx context.Context, address block.Address) (*big.Int, e
 // GetGasPrice 获取gas price
 func (e *Eth) GetGasPrice(ctx context.Context) (*big.Int, error) {
 	var result string
-	err := e.client.Call("eth_gasPrice", &result)
+	err := e.client.CallContext(ctx, "eth_gasPrice", &result)
 	if err != nil {
 		return nil, err
 	}
@@ -121,21 +161,12 @@ func (e *Eth) GetGasPrice(ctx context.Context) (*big.Int, error) {
 // BlockByNumber 根据区块高度获取区块信息
 func (e *Eth) BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error) {
 	var blockData block.Block
-	err := e.client.Call("eth_getBlockByNumber", &blockData, math.HexOrDecimal64(height), full)
+	err := e.client.CallContext(ctx, "eth_getBlockByNumber", &blockData, math.HexOrDecimal64(height), full)
 	if err != nil {
 		return nil, err
 	}
 	if full {
-		var batch []rpc.BatchElem
-		for idx := range blockData.Transactions {
-			blockData.Transactions[idx].Receipt = new(block.Receipt)
-			batch = append(batch, rpc.BatchElem{
-				Method: "eth_getTransactionReceipt",
-				Args:   []interface{}{blockData.Transactions[idx].Hash},
-				Result: blockData.Transactions[idx].Receipt,
-			})
-		}
-		err = e.client.BatchCall(batch, true)
+		err = e.fillReceipts(ctx, []*block.Block{&blockData})
 	}
 	return &blockData, err
 }
@@ -152,24 +183,17 @@ func (e *Eth) BlocksByNumbers(ctx context.Context, heights []uint64, full bool)
 			Result: blocks[idx],
 		})
 	}
-	err := e.client.BatchCall(blockBatch, true)
+	err := e.client.BatchCallContext(ctx, blockBatch, true)
 	if err != nil {
 		return nil, err
 	}
 	if full {
-		var receipts []rpc.BatchElem
 		for blockIdx := range blocks {
 			for txIdx := range blocks[blockIdx].Transactions {
-				blocks[blockIdx].Transactions[txIdx].Receipt = new(block.Receipt)
 				blocks[blockIdx].Transactions[txIdx].InternalTraceCalls = make([]*block.InternalTxCallTrace, 0)
-				receipts = append(receipts, rpc.BatchElem{
-					Method: "eth_getTransactionReceipt",
-					Args:   []interface{}{blocks[blockIdx].Transactions[txIdx].Hash},
-					Result: blocks[blockIdx].Transactions[txIdx].Receipt,
-				})
 			}
 		}
-		err = e.client.BatchCall(receipts, true)
+		err = e.fillReceipts(ctx, blocks)
 	}
 	return blocks, err
 }
@@ -177,7 +201,7 @@ func (e *Eth) BlocksByNumbers(ctx context.Context, heights []uint64, full bool)
 // TransactionByHash 根据交易hash获取交易信息
 func (e *Eth) TransactionByHash(ctx context.Context, hash block.Hash, full bool) (*block.Transaction, error) {
 	var tx block.Transaction
-	err := e.client.Call("eth_getTransactionByHash", &tx, hash)
+	err := e.client.CallContext(ctx, "eth_getTransactionByHash", &tx, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -185,7 +209,7 @@ func (e *Eth) TransactionByHash(ctx context.Context, hash block.Hash, full bool)
 		return &tx, nil
 	}
 	tx.Receipt = new(block.Receipt)
-	err = e.client.Call("eth_getTransactionReceipt", tx.Receipt, hash)
+	err = e.client.CallContext(ctx, "eth_getTransactionReceipt", tx.Receipt, hash)
 	return &tx, err
 }
 
@@ -202,7 +226,7 @@ func (e *Eth) TransactionsByHashList(ctx context.Context, hashList []block.Hash,
 			Result: txList[idx],
 		})
 	}
-	err := e.client.BatchCall(txBatch, true)
+	err := e.client.BatchCallContext(ctx, txBatch, true)
 	if err != nil {
 		return nil, err
 	}
@@ -217,14 +241,14 @@ func (e *Eth) TransactionsByHashList(ctx context.Context, hashList []block.Hash,
 			Result: txList[idx].Receipt,
 		})
 	}
-	err = e.client.BatchCall(receiptBatch, true)
+	err = e.client.BatchCallContext(ctx, receiptBatch, true)
 	return txList, err
 }
 
 // EstimateGas 矿工费估算
 func (e *Eth) EstimateGas(ctx context.Context, call CallParameter) (*big.Int, error) {
 	var result string
-	err := e.client.Call("eth_estimateGas", &result, call.ToArg())
+	err := e.client.CallContext(ctx, "eth_estimateGas", &result, call.ToArg())
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +258,7 @@ func (e *Eth) EstimateGas(ctx context.Context, call CallParameter) (*big.Int, er
 // GasTipCap 矿工费预估
 func (e *Eth) GasTipCap(ctx context.Context) (*big.Int, error) {
 	var result string
-	err := e.client.Call("eth_maxPriorityFeePerGas", &result)
+	err := e.client.CallContext(ctx, "eth_maxPriorityFeePerGas", &result)
 	if err != nil {
 		return nil, err
 	}
@@ -244,13 +268,17 @@ func (e *Eth) GasTipCap(ctx context.Context) (*big.Int, error) {
 // ChainID 获取链ID
 func (e *Eth) ChainID(ctx context.Context) (*big.Int, error) {
 	var chainID math.HexOrDecimal64
-	err := e.client.Call("eth_chainId", &chainID)
+	err := e.client.CallContext(ctx, "eth_chainId", &chainID)
 	if err != nil {
 		return nil, err
 	}
+	if e.chainID != 0 && uint64(chainID) != e.chainID {
+		return nil, errs.New(errs.ChainIDMismatch, fmt.Sprintf("node chain id is %d, expect %d", uint64(chainID), e.chainID))
+	}
 	return big.NewInt(int64(chainID)), nil
 }
 
+// InternalTxs 按交易追踪完整的调用树，只需要原生币转账时使用 block.FilterTraces(traces, block.ValueTransfers)
 func (e *Eth) InternalTxs(ctx context.Context, txHashes []block.Hash, clientType EthClientType) (map[string][]*block.InternalTxCallTrace, error) {
 	switch clientType {
 	case ErigonType:
@@ -261,19 +289,35 @@ func (e *Eth) InternalTxs(ctx context.Context, txHashes []block.Hash, clientType
 	return nil, fmt.Errorf("clientType [%s] is not support", clientType)
 }
 
+// ErigonCallerTrace trace_transaction 及 trace_block 返回的trace
 type ErigonCallerTrace struct {
 	Action struct {
-		From     block.Hex `json:"from"`
-		CallType string    `json:"callType"`
-		To       block.Hex `json:"to"`
-		Value    string    `json:"value"`
+		From     block.Hex      `json:"from"`
+		CallType string         `json:"callType"`
+		To       block.Hex      `json:"to"`
+		Value    string         `json:"value"`
+		Gas      hexutil.Uint64 `json:"gas"`
+		Input    block.Hex      `json:"input"`
+		// Init CreationMethod 合约创建
+		Init           block.Hex `json:"init"`
+		CreationMethod string    `json:"creationMethod"`
+		// Address RefundAddress Balance 合约自毁
+		Address       block.Hex `json:"address"`
+		RefundAddress block.Hex `json:"refundAddress"`
+		Balance       string    `json:"balance"`
 	} `json:"action"`
 	TransactionHash block.Hex `json:"transactionHash"`
+	BlockHash       block.Hex `json:"blockHash"`
 	BlockNumber     uint64    `json:"blockNumber"`
+	TraceAddress    []int     `json:"traceAddress"`
 	Result          struct {
-		Address block.Hex `json:"address"`
+		Address block.Hex      `json:"address"`
+		Code    block.Hex      `json:"code"`
+		GasUsed hexutil.Uint64 `json:"gasUsed"`
+		Output  block.Hex      `json:"output"`
 	}
-	Type string `json:"type"`
+	Error string `json:"error"`
+	Type  string `json:"type"`
 }
 
 func (e *Eth) erigonInternalTx(ctx context.Context, txHashes []block.Hash) (map[string][]*block.InternalTxCallTrace, error) {
@@ -288,43 +332,169 @@ func (e *Eth) erigonInternalTx(ctx context.Context, txHashes []block.Hash) (map[
 			Result: &internalTxs[idx],
 		})
 	}
-	if err := e.internalTxClient.BatchCall(elems, true); err != nil {
+	if err := e.internalTxClient.BatchCallContext(ctx, elems, true); err != nil {
 		return nil, err
 	}
 	for _, internalTx := range internalTxs {
-		if len(internalTx) == 0 {
+		appendErigonTraces(result, internalTx)
+	}
+	return result, nil
+}
+
+// appendErigonTraces 按交易展开trace，区块奖励等不属于交易的trace忽略
+func appendErigonTraces(result map[string][]*block.InternalTxCallTrace, traces []ErigonCallerTrace) {
+	for idx := range traces {
+		callTrance := &traces[idx]
+		if len(callTrance.TransactionHash) == 0 {
 			continue
 		}
-		for _, callTrance := range internalTx {
-			if _, ok := result[callTrance.TransactionHash.Hex()]; !ok {
-				result[callTrance.TransactionHash.Hex()] = make([]*block.InternalTxCallTrace, 0)
+		trace := &block.InternalTxCallTrace{
+			BlockHash:    callTrance.BlockHash,
+			BlockNumber:  callTrance.BlockNumber,
+			TxHash:       callTrance.TransactionHash,
+			From:         callTrance.Action.From,
+			To:           callTrance.Action.To,
+			TraceAddress: callTrance.TraceAddress,
+			Depth:        len(callTrance.TraceAddress),
+			Gas:          uint64(callTrance.Action.Gas),
+			GasUsed:      uint64(callTrance.Result.GasUsed),
+			Input:        callTrance.Action.Input,
+			Output:       callTrance.Result.Output,
+			Error:        callTrance.Error,
+		}
+		if trace.TraceAddress == nil {
+			trace.TraceAddress = []int{}
+		}
+		value := callTrance.Action.Value
+		switch strings.ToLower(callTrance.Type) {
+		case "create":
+			trace.CallType = "create"
+			if callTrance.Action.CreationMethod != "" {
+				trace.CallType = strings.ToLower(callTrance.Action.CreationMethod)
 			}
-			if strings.EqualFold(callTrance.Type, "create") {
-				result[callTrance.TransactionHash.Hex()] = append(result[callTrance.TransactionHash.Hex()], &block.InternalTxCallTrace{
-					BlockNumber:     callTrance.BlockNumber,
-					TxHash:          callTrance.TransactionHash,
-					From:            callTrance.Action.From,
-					ContractAddress: callTrance.Result.Address,
-				})
-			} else {
-				if len(callTrance.Action.Value) > 2 && !strings.EqualFold(callTrance.Action.Value, "0x0") {
-					bigInt, _ := block.HexStrToBigInt(callTrance.Action.Value)
-					result[callTrance.TransactionHash.Hex()] = append(result[callTrance.TransactionHash.Hex()], &block.InternalTxCallTrace{
-						BlockNumber: callTrance.BlockNumber,
-						TxHash:      callTrance.TransactionHash,
-						From:        callTrance.Action.From,
-						To:          callTrance.Action.To,
-						Value:       block.BigInt(*bigInt),
-					})
-				}
+			trace.To = callTrance.Result.Address
+			trace.ContractAddress = callTrance.Result.Address
+			trace.Input = callTrance.Action.Init
+			trace.Output = callTrance.Result.Code
+		case "suicide", "selfdestruct":
+			trace.CallType = "selfdestruct"
+			trace.From = callTrance.Action.Address
+			trace.To = callTrance.Action.RefundAddress
+			value = callTrance.Action.Balance
+		default:
+			trace.CallType = strings.ToLower(callTrance.Action.CallType)
+		}
+		if len(value) > 2 {
+			if bigInt, err := block.HexStrToBigInt(value); err == nil {
+				trace.Value = block.BigInt(*bigInt)
 			}
 		}
+		if trace.Error != "" {
+			trace.RevertReason = errs.UnpackRevert(trace.Output)
+		}
+		txHash := callTrance.TransactionHash.Hex()
+		result[txHash] = append(result[txHash], trace)
+	}
+	for _, traces := range result {
+		markReverted(traces)
 	}
-	return result, nil
 }
 
+// markReverted trace按深度优先排列，上层调用失败时子调用同样被回滚
+func markReverted(traces []*block.InternalTxCallTrace) {
+	stack := make([]*block.InternalTxCallTrace, 0)
+	for _, trace := range traces {
+		if trace.Depth < len(stack) {
+			stack = stack[:trace.Depth]
+		}
+		trace.Reverted = trace.Error != "" || (len(stack) > 0 && stack[len(stack)-1].Reverted)
+		stack = append(stack, trace)
+	}
+}
+
+// GethCallFrame debug_traceTransaction 使用 callTracer 时返回的调用帧
+type GethCallFrame struct {
+	Type         string          `json:"type"`
+	From         block.Hex       `json:"from"`
+	To           block.Hex       `json:"to"`
+	Value        *hexutil.Big    `json:"value"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        block.Hex       `json:"input"`
+	Output       block.Hex       `json:"output"`
+	Error        string          `json:"error"`
+	RevertReason string          `json:"revertReason"`
+	Calls        []GethCallFrame `json:"calls"`
+}
+
+// gethCallTracer debug_traceTransaction 的tracer参数
+var gethCallTracer = map[string]interface{}{"tracer": "callTracer"}
+
+// gethInternalTx 使用 callTracer 追踪交易，按深度优先的顺序展开整个调用树，包括顶层调用
 func (e *Eth) gethInternalTx(ctx context.Context, txHashes []block.Hash) (map[string][]*block.InternalTxCallTrace, error) {
 	var result = make(map[string][]*block.InternalTxCallTrace)
-
+	elems := make([]rpc.BatchElem, 0)
+	frames := make([]GethCallFrame, len(txHashes))
+	for idx := range txHashes {
+		elems = append(elems, rpc.BatchElem{
+			Method: "debug_traceTransaction",
+			Args:   []interface{}{txHashes[idx].String(), gethCallTracer},
+			Result: &frames[idx],
+		})
+	}
+	if err := e.internalTxClient.BatchCallContext(ctx, elems, true); err != nil {
+		return nil, err
+	}
+	// callTracer 的结果不包含区块信息，从交易中获取
+	txs, err := e.TransactionsByHashList(ctx, txHashes, false)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range frames {
+		traces := make([]*block.InternalTxCallTrace, 0)
+		flattenGethFrame(&frames[idx], block.Hex(txHashes[idx].Bytes()), []int{}, false, &traces)
+		for _, trace := range traces {
+			trace.BlockNumber = uint64(txs[idx].BlockNumber)
+			if txs[idx].BlockHash != (block.Hash{}) {
+				trace.BlockHash = txs[idx].BlockHash.Bytes()
+			}
+		}
+		result[txHashes[idx].String()] = traces
+	}
 	return result, nil
 }
+
+// flattenGethFrame 展开调用帧，上层调用失败时子调用也标记为已回滚
+func flattenGethFrame(frame *GethCallFrame, txHash block.Hex, traceAddress []int, parentReverted bool, traces *[]*block.InternalTxCallTrace) {
+	trace := &block.InternalTxCallTrace{
+		From:         frame.From,
+		To:           frame.To,
+		TxHash:       txHash,
+		CallType:     strings.ToLower(frame.Type),
+		TraceAddress: traceAddress,
+		Depth:        len(traceAddress),
+		Gas:          uint64(frame.Gas),
+		GasUsed:      uint64(frame.GasUsed),
+		Input:        frame.Input,
+		Output:       frame.Output,
+		Error:        frame.Error,
+		RevertReason: frame.RevertReason,
+		Reverted:     parentReverted || frame.Error != "",
+	}
+	if trace.Error != "" && trace.RevertReason == "" {
+		trace.RevertReason = errs.UnpackRevert(frame.Output)
+	}
+	if frame.Value != nil {
+		trace.Value = block.BigInt(*frame.Value.ToInt())
+	}
+	if trace.IsCreate() {
+		trace.ContractAddress = frame.To
+	}
+	*traces = append(*traces, trace)
+	for idx := range frame.Calls {
+		childAddress := make([]int, len(traceAddress)+1)
+		copy(childAddress, traceAddress)
+		childAddress[len(traceAddress)] = idx
+		flattenGethFrame(&frame.Calls[idx], txHash, childAddress, trace.Reverted, traces)
+	}
+}
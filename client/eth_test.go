@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"testing"
+)
+
+// newReplayEth 使用testdata中录制的fixture创建 Eth，不访问网络
+func newReplayEth(t *testing.T, fixture string, mode transport.MatchMode) (Provider, *transport.Replay) {
+	replay, err := transport.LoadReplay("testdata/"+fixture, mode)
+	assert.NoError(t, err)
+	client, err := jsonrpc.NewClient(jsonrpc.WithSharedTransport(fixture, replay), jsonrpc.WithRpcClose(),
+		jsonrpc.WithInitCap(0), jsonrpc.WithMaxIdle(1), jsonrpc.WithMaxCap(1), jsonrpc.WithIdleTimeout(jsonrpc.DefaultIdleTimeout))
+	assert.NoError(t, err)
+	t.Cleanup(client.Release)
+	return NewEthClient(client, client), replay
+}
+
+func TestEth_replay(t *testing.T) {
+	ctx := context.Background()
+	eth, replay := newReplayEth(t, "eth_block.json", transport.MatchStrict)
+
+	chainID, err := eth.ChainID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), chainID.Int64())
+
+	head, err := eth.BlockNumber(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000000), head)
+
+	b, err := eth.BlockByNumber(ctx, head-1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(999999), uint64(b.Number))
+	assert.Len(t, b.Transactions, 1)
+	tx := b.Transactions[0]
+	assert.Equal(t, "0xea1093d492a1dcb1bef708f771a99a96ff05dcab81ca76c31940300177fcf49f", tx.Hash.String())
+	assert.Equal(t, tx.Hash, tx.Receipt.TransactionHash)
+	assert.Equal(t, uint64(1), uint64(tx.Receipt.Status))
+
+	balance, err := eth.BalanceAt(ctx, *tx.To)
+	assert.NoError(t, err)
+	assert.Equal(t, tx.Value.ToBigInt(), balance)
+
+	_, err = eth.BlocksByNumbers(ctx, []uint64{head + 1}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, replay.Remaining())
+}
+
+func TestEth_replayLenient(t *testing.T) {
+	eth, _ := newReplayEth(t, "eth_block.json", transport.MatchLenient)
+	blocks, err := eth.BlocksByNumbers(context.Background(), []uint64{999999, 999999}, true)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 2)
+	assert.Equal(t, blocks[0].Hash, blocks[1].Hash)
+	for _, b := range blocks {
+		assert.Equal(t, b.Transactions[0].Hash, b.Transactions[0].Receipt.TransactionHash)
+	}
+}
+
+type headProvider struct {
+	Provider
+	chainID uint64
+	baseFee *block.BigInt
+}
+
+func (p *headProvider) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).SetUint64(p.chainID), nil
+}
+
+func (p *headProvider) BlockNumber(ctx context.Context) (uint64, error) {
+	return 1, nil
+}
+
+func (p *headProvider) BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error) {
+	return &block.Block{BaseFeePerGas: p.baseFee}, nil
+}
+
+func TestEth_chain(t *testing.T) {
+	ctx := context.Background()
+	eth, _ := newReplayEth(t, "eth_block.json", transport.MatchLenient)
+	chain, err := ChainOf(ctx, eth)
+	assert.NoError(t, err)
+	assert.Equal(t, "ethereum", chain.Name)
+	assert.Equal(t, 18, chain.NativeDecimals)
+	assert.True(t, chain.EIP1559)
+
+	_, ok := LookupChain(0xdead)
+	assert.False(t, ok)
+	// 未注册的链按最新区块是否有 baseFeePerGas 判断是否支持EIP-1559
+	chain, err = ChainOf(ctx, &headProvider{chainID: 0xdead})
+	assert.NoError(t, err)
+	assert.False(t, chain.EIP1559)
+	chain, err = ChainOf(ctx, &headProvider{chainID: 0xdead, baseFee: new(block.BigInt)})
+	assert.NoError(t, err)
+	assert.True(t, chain.EIP1559)
+
+	RegisterChain(Chain{ID: 0xdead, Name: "custom", FinalityDepth: 3})
+	t.Cleanup(func() { UnregisterChain(0xdead) })
+	chain, ok = LookupChain(0xdead)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), chain.FinalityDepth)
+	UnregisterChain(0xdead)
+	_, ok = LookupChain(0xdead)
+	assert.False(t, ok)
+
+	// 节点的链id与期望不一致
+	arbitrum := NewEthClient(eth.(*Eth).client, nil, WithChainID(42161))
+	_, err = arbitrum.ChainID(ctx)
+	assert.ErrorIs(t, err, errs.ChainIDMismatch)
+}
+
+func Test_flattenGethFrame(t *testing.T) {
+	// 顶层调用创建合约，合约转账后自毁，其中一个子调用revert
+	raw := `{"type":"CALL","from":"0x01","to":"0x02","value":"0x10","gas":"0x5208","gasUsed":"0x5000","input":"0x","calls":[
+		{"type":"CREATE2","from":"0x02","to":"0x03","value":"0x0","gas":"0x100","gasUsed":"0x80","input":"0x6080","output":"0x6080"},
+		{"type":"CALL","from":"0x02","to":"0x04","value":"0x1","gas":"0x100","gasUsed":"0x100","input":"0x","error":"execution reverted",
+			"output":"0x08c379a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000026e6f000000000000000000000000000000000000000000000000000000000000","calls":[
+			{"type":"DELEGATECALL","from":"0x04","to":"0x05","gas":"0x10","gasUsed":"0x1","input":"0x"}
+		]},
+		{"type":"SELFDESTRUCT","from":"0x02","to":"0x01","value":"0x5"}
+	]}`
+	var frame GethCallFrame
+	assert.NoError(t, json.Unmarshal([]byte(raw), &frame))
+	traces := make([]*block.InternalTxCallTrace, 0)
+	flattenGethFrame(&frame, block.Hex{0xaa}, []int{}, false, &traces)
+	assert.Len(t, traces, 5)
+
+	assert.Equal(t, "call", traces[0].CallType)
+	assert.Equal(t, []int{}, traces[0].TraceAddress)
+	assert.Equal(t, uint64(0x5000), traces[0].GasUsed)
+	assert.Equal(t, int64(16), traces[0].Value.ToBigInt().Int64())
+
+	assert.Equal(t, "create2", traces[1].CallType)
+	assert.Equal(t, block.Hex{0x03}, traces[1].ContractAddress)
+	assert.Equal(t, block.Hex{0x60, 0x80}, traces[1].Output)
+
+	assert.Equal(t, []int{1}, traces[2].TraceAddress)
+	assert.Equal(t, "execution reverted", traces[2].Error)
+	assert.Equal(t, "no", traces[2].RevertReason)
+	assert.True(t, traces[2].Reverted)
+
+	// 上层调用revert，子调用也被回滚
+	assert.Equal(t, "delegatecall", traces[3].CallType)
+	assert.Equal(t, []int{1, 0}, traces[3].TraceAddress)
+	assert.Equal(t, 2, traces[3].Depth)
+	assert.Empty(t, traces[3].Error)
+	assert.True(t, traces[3].Reverted)
+
+	assert.Equal(t, "selfdestruct", traces[4].CallType)
+	assert.False(t, traces[4].Reverted)
+	assert.Equal(t, block.Hex{0xaa}, traces[4].TxHash)
+}
+
+func Test_appendErigonTraces(t *testing.T) {
+	// 顶层调用创建合约，revert的子调用中有一笔转账，合约自毁退回余额，最后是区块奖励
+	raw := `[
+		{"type":"call","action":{"callType":"call","from":"0x01","to":"0x02","value":"0x10","gas":"0x5208","input":"0x"},"result":{"gasUsed":"0x5000","output":"0x"},"traceAddress":[],"transactionHash":"0xaa","blockNumber":7},
+		{"type":"create","action":{"from":"0x02","value":"0x0","gas":"0x100","init":"0x6080","creationMethod":"create2"},"result":{"address":"0x03","code":"0x6080","gasUsed":"0x80"},"traceAddress":[0],"transactionHash":"0xaa","blockNumber":7},
+		{"type":"call","action":{"callType":"call","from":"0x02","to":"0x04","value":"0x0","gas":"0x100","input":"0x"},"result":null,"error":"Reverted","traceAddress":[1],"transactionHash":"0xaa","blockNumber":7},
+		{"type":"call","action":{"callType":"call","from":"0x04","to":"0x05","value":"0x1","gas":"0x10","input":"0x"},"result":{"gasUsed":"0x1","output":"0x"},"traceAddress":[1,0],"transactionHash":"0xaa","blockNumber":7},
+		{"type":"suicide","action":{"address":"0x02","refundAddress":"0x01","balance":"0x5"},"result":null,"traceAddress":[2],"transactionHash":"0xaa","blockNumber":7},
+		{"type":"reward","action":{"author":"0x06","rewardType":"block","value":"0x1"},"result":null,"traceAddress":[],"transactionHash":null,"blockNumber":7}
+	]`
+	var traces []ErigonCallerTrace
+	assert.NoError(t, json.Unmarshal([]byte(raw), &traces))
+	result := make(map[string][]*block.InternalTxCallTrace)
+	appendErigonTraces(result, traces)
+	assert.Len(t, result, 1)
+	calls := result["0xaa"]
+	assert.Len(t, calls, 5)
+
+	assert.Equal(t, "create2", calls[1].CallType)
+	assert.Equal(t, block.Hex{0x03}, calls[1].ContractAddress)
+	assert.Equal(t, block.Hex{0x60, 0x80}, calls[1].Input)
+	assert.True(t, calls[2].Reverted)
+	assert.True(t, calls[3].Reverted)
+	assert.Equal(t, 2, calls[3].Depth)
+	assert.Equal(t, "selfdestruct", calls[4].CallType)
+	assert.Equal(t, block.Hex{0x02}, calls[4].From)
+	assert.Equal(t, block.Hex{0x01}, calls[4].To)
+	assert.Equal(t, int64(5), calls[4].Value.ToBigInt().Int64())
+
+	// 回滚的转账不计入
+	transfers := block.FilterTraces(calls, block.ValueTransfers)
+	assert.Equal(t, []*block.InternalTxCallTrace{calls[0], calls[4]}, transfers)
+	assert.Equal(t, []*block.InternalTxCallTrace{calls[0], calls[1], calls[4]}, block.FilterTraces(calls, block.AnyOf(block.ValueTransfers, block.Creations)))
+	assert.Len(t, block.FilterTraces(calls, block.Succeeded), 3)
+}
+
+func TestEth_blockReceiptsMismatch(t *testing.T) {
+	// eth_getBlockReceipts 返回的回执属于另一个区块(如发生了重组)，退化为逐笔获取
+	eth, replay := newReplayEth(t, "eth_block_receipts.json", transport.MatchStrict)
+	b, err := eth.BlockByNumber(context.Background(), 999999, true)
+	assert.NoError(t, err)
+	assert.Equal(t, b.Hash, b.Transactions[0].Receipt.BlockHash)
+	assert.Equal(t, 0, replay.Remaining())
+}
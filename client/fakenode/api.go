@@ -0,0 +1,462 @@
+package fakenode
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+)
+
+var errBlockNotFound = errors.New("header not found")
+
+// ethAPI eth_ 命名空间
+type ethAPI struct {
+	n *Node
+}
+
+// callArgs eth_call 及 eth_estimateGas 的参数
+type callArgs struct {
+	From     *common.Address `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      *hexutil.Uint64 `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Data     *hexutil.Bytes  `json:"data"`
+	Input    *hexutil.Bytes  `json:"input"`
+}
+
+func (args *callArgs) data() []byte {
+	if args.Input != nil {
+		return *args.Input
+	}
+	if args.Data != nil {
+		return *args.Data
+	}
+	return nil
+}
+
+func (api *ethAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(api.n.ChainID())
+}
+
+func (api *ethAPI) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(api.n.Head().NumberU64())
+}
+
+func (api *ethAPI) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).Add(api.n.baseFee, DefaultGasTipCap))
+}
+
+func (api *ethAPI) MaxPriorityFeePerGas() *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).Set(DefaultGasTipCap))
+}
+
+func (api *ethAPI) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	b, err := api.n.blockByNumber(number)
+	if err != nil {
+		// 区块不存在时与geth一致返回null
+		return nil, nil
+	}
+	return marshalBlock(b, full), nil
+}
+
+func (api *ethAPI) GetBlockByHash(hash common.Hash, full bool) map[string]interface{} {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	b, ok := api.n.byHash[hash]
+	if !ok {
+		return nil
+	}
+	return marshalBlock(b, full)
+}
+
+func (api *ethAPI) GetTransactionByHash(hash common.Hash) map[string]interface{} {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	if lookup, ok := api.n.txs[hash]; ok {
+		return marshalTx(lookup.tx, lookup.from, lookup.block, lookup.index)
+	}
+	for _, tx := range api.n.pending {
+		if tx.Hash() == hash {
+			from, _ := types.Sender(api.n.signer, tx)
+			return marshalTx(tx, from, nil, 0)
+		}
+	}
+	return nil
+}
+
+func (api *ethAPI) GetTransactionReceipt(hash common.Hash) map[string]interface{} {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	lookup, ok := api.n.txs[hash]
+	if !ok {
+		return nil
+	}
+	return marshalReceipt(lookup)
+}
+
+// GetBlockReceipts 区块中所有交易的回执
+func (api *ethAPI) GetBlockReceipts(blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	b, err := api.n.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	receipts := make([]map[string]interface{}, 0, len(b.receipts))
+	for idx, tx := range b.block.Transactions() {
+		receipts = append(receipts, marshalReceipt(&txLookup{tx: tx, from: b.senders[idx], block: b, index: idx}))
+	}
+	return receipts, nil
+}
+
+func (api *ethAPI) GetBalance(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	b, err := api.n.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(b.state.balance(address)), nil
+}
+
+func (api *ethAPI) GetTransactionCount(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	if number, ok := blockNrOrHash.Number(); ok && number == rpc.PendingBlockNumber {
+		nonce := hexutil.Uint64(api.n.pendingState().nonces[address])
+		return &nonce, nil
+	}
+	b, err := api.n.blockByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	nonce := hexutil.Uint64(b.state.nonces[address])
+	return &nonce, nil
+}
+
+func (api *ethAPI) SendRawTransaction(input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.n.SendTransaction(tx); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+func (api *ethAPI) EstimateGas(args callArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+	gas, err := intrinsicGas(args.data(), nil, args.To == nil)
+	return hexutil.Uint64(gas), err
+}
+
+// Call 返回 SetCallResult 设置的结果，按calldata前缀最长匹配
+func (api *ethAPI) Call(args callArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if args.To == nil {
+		return hexutil.Bytes{}, nil
+	}
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	data := args.data()
+	for size := len(data); size >= 0; size-- {
+		if result, ok := api.n.calls[callKey(*args.To, data[:size])]; ok {
+			return result, nil
+		}
+	}
+	return hexutil.Bytes{}, nil
+}
+
+// traceAPI trace_ 命名空间，返回 erigon/openethereum 格式的trace
+type traceAPI struct {
+	n *Node
+}
+
+// Transaction 转账只有顶层的一个call或者create
+func (api *traceAPI) Transaction(hash common.Hash) ([]map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	lookup, ok := api.n.txs[hash]
+	if !ok {
+		return nil, nil
+	}
+	return []map[string]interface{}{erigonTrace(lookup.block, lookup.index)}, nil
+}
+
+// Block 区块内每笔交易的trace，最后是不属于任何交易的出块奖励
+func (api *traceAPI) Block(number rpc.BlockNumber) ([]map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	if err := api.n.fail("trace_block"); err != nil {
+		return nil, err
+	}
+	b, err := api.n.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	traces := make([]map[string]interface{}, 0, len(b.receipts)+1)
+	for idx := range b.receipts {
+		traces = append(traces, erigonTrace(b, idx))
+	}
+	traces = append(traces, map[string]interface{}{
+		"blockHash":           b.block.Hash(),
+		"blockNumber":         b.block.NumberU64(),
+		"transactionHash":     nil,
+		"transactionPosition": nil,
+		"subtraces":           0,
+		"traceAddress":        []int{},
+		"type":                "reward",
+		"action": map[string]interface{}{
+			"author":     b.block.Coinbase(),
+			"rewardType": "block",
+			"value":      (*hexutil.Big)(big.NewInt(0)),
+		},
+	})
+	return traces, nil
+}
+
+func erigonTrace(b *minedBlock, index int) map[string]interface{} {
+	tx := b.block.Transactions()[index]
+	receipt := b.receipts[index]
+	trace := map[string]interface{}{
+		"blockHash":           b.block.Hash(),
+		"blockNumber":         b.block.NumberU64(),
+		"transactionHash":     tx.Hash(),
+		"transactionPosition": index,
+		"subtraces":           0,
+		"traceAddress":        []int{},
+	}
+	if tx.To() == nil {
+		trace["type"] = "create"
+		trace["action"] = map[string]interface{}{
+			"from":  b.senders[index],
+			"gas":   hexutil.Uint64(tx.Gas()),
+			"init":  hexutil.Bytes(tx.Data()),
+			"value": (*hexutil.Big)(tx.Value()),
+		}
+		trace["result"] = map[string]interface{}{
+			"address": receipt.ContractAddress,
+			"code":    hexutil.Bytes{},
+			"gasUsed": hexutil.Uint64(receipt.GasUsed),
+		}
+	} else {
+		trace["type"] = "call"
+		trace["action"] = map[string]interface{}{
+			"callType": "call",
+			"from":     b.senders[index],
+			"to":       tx.To(),
+			"gas":      hexutil.Uint64(tx.Gas()),
+			"input":    hexutil.Bytes(tx.Data()),
+			"value":    (*hexutil.Big)(tx.Value()),
+		}
+		trace["result"] = map[string]interface{}{
+			"gasUsed": hexutil.Uint64(receipt.GasUsed),
+			"output":  hexutil.Bytes{},
+		}
+	}
+	return trace
+}
+
+// debugAPI debug_ 命名空间，返回 geth callTracer 格式的trace，忽略tracer参数
+type debugAPI struct {
+	n *Node
+}
+
+// TraceTransaction 转账只有顶层的一个调用帧
+func (api *debugAPI) TraceTransaction(hash common.Hash, config map[string]interface{}) (map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	lookup, ok := api.n.txs[hash]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", hash)
+	}
+	return callFrame(lookup.block, lookup.index), nil
+}
+
+// TraceBlockByNumber 区块内每笔交易的调用帧
+func (api *debugAPI) TraceBlockByNumber(number rpc.BlockNumber, config map[string]interface{}) ([]map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	if err := api.n.fail("debug_traceBlockByNumber"); err != nil {
+		return nil, err
+	}
+	b, err := api.n.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return blockFrames(b), nil
+}
+
+// TraceBlockByHash 旧分叉上的区块同样可以追踪
+func (api *debugAPI) TraceBlockByHash(hash common.Hash, config map[string]interface{}) ([]map[string]interface{}, error) {
+	api.n.mu.Lock()
+	defer api.n.mu.Unlock()
+	if err := api.n.fail("debug_traceBlockByHash"); err != nil {
+		return nil, err
+	}
+	b, ok := api.n.byHash[hash]
+	if !ok {
+		return nil, errBlockNotFound
+	}
+	return blockFrames(b), nil
+}
+
+func blockFrames(b *minedBlock) []map[string]interface{} {
+	traces := make([]map[string]interface{}, 0, len(b.receipts))
+	for idx, tx := range b.block.Transactions() {
+		traces = append(traces, map[string]interface{}{"txHash": tx.Hash(), "result": callFrame(b, idx)})
+	}
+	return traces
+}
+
+func callFrame(b *minedBlock, index int) map[string]interface{} {
+	tx := b.block.Transactions()[index]
+	receipt := b.receipts[index]
+	frame := map[string]interface{}{
+		"type":    "CALL",
+		"from":    b.senders[index],
+		"to":      tx.To(),
+		"value":   (*hexutil.Big)(tx.Value()),
+		"gas":     hexutil.Uint64(tx.Gas()),
+		"gasUsed": hexutil.Uint64(receipt.GasUsed),
+		"input":   hexutil.Bytes(tx.Data()),
+	}
+	if tx.To() == nil {
+		frame["type"] = "CREATE"
+		frame["to"] = receipt.ContractAddress
+	}
+	return frame
+}
+
+func (n *Node) blockByNumber(number rpc.BlockNumber) (*minedBlock, error) {
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber, rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		return n.head(), nil
+	case rpc.EarliestBlockNumber:
+		return n.chain[0], nil
+	}
+	if number < 0 || int64(number) >= int64(len(n.chain)) {
+		return nil, errBlockNotFound
+	}
+	return n.chain[number], nil
+}
+
+func (n *Node) blockByNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash) (*minedBlock, error) {
+	if number, ok := blockNrOrHash.Number(); ok {
+		return n.blockByNumber(number)
+	}
+	hash, _ := blockNrOrHash.Hash()
+	b, ok := n.byHash[hash]
+	if !ok {
+		return nil, errBlockNotFound
+	}
+	return b, nil
+}
+
+func marshalBlock(b *minedBlock, full bool) map[string]interface{} {
+	header := b.block.Header()
+	fields := map[string]interface{}{
+		"number":           (*hexutil.Big)(header.Number),
+		"hash":             b.block.Hash(),
+		"parentHash":       header.ParentHash,
+		"nonce":            header.Nonce,
+		"mixHash":          header.MixDigest,
+		"sha3Uncles":       header.UncleHash,
+		"logsBloom":        header.Bloom,
+		"stateRoot":        header.Root,
+		"miner":            header.Coinbase,
+		"difficulty":       (*hexutil.Big)(header.Difficulty),
+		"extraData":        hexutil.Bytes(header.Extra),
+		"size":             hexutil.Uint64(b.block.Size()),
+		"gasLimit":         hexutil.Uint64(header.GasLimit),
+		"gasUsed":          hexutil.Uint64(header.GasUsed),
+		"timestamp":        hexutil.Uint64(header.Time),
+		"transactionsRoot": header.TxHash,
+		"receiptsRoot":     header.ReceiptHash,
+		"baseFeePerGas":    (*hexutil.Big)(header.BaseFee),
+		"uncles":           []common.Hash{},
+	}
+	txs := make([]interface{}, len(b.block.Transactions()))
+	for idx, tx := range b.block.Transactions() {
+		if full {
+			txs[idx] = marshalTx(tx, b.senders[idx], b, idx)
+		} else {
+			txs[idx] = tx.Hash()
+		}
+	}
+	fields["transactions"] = txs
+	return fields
+}
+
+// marshalTx b为空时表示交易还在交易池中
+func marshalTx(tx *types.Transaction, from common.Address, b *minedBlock, index int) map[string]interface{} {
+	v, r, s := tx.RawSignatureValues()
+	fields := map[string]interface{}{
+		"type":     hexutil.Uint64(tx.Type()),
+		"hash":     tx.Hash(),
+		"from":     from,
+		"to":       tx.To(),
+		"input":    hexutil.Bytes(tx.Data()),
+		"gas":      hexutil.Uint64(tx.Gas()),
+		"gasPrice": (*hexutil.Big)(tx.GasPrice()),
+		"value":    (*hexutil.Big)(tx.Value()),
+		"nonce":    hexutil.Uint64(tx.Nonce()),
+		"v":        (*hexutil.Big)(v),
+		"r":        (*hexutil.Big)(r),
+		"s":        (*hexutil.Big)(s),
+	}
+	if b != nil {
+		fields["blockHash"] = b.block.Hash()
+		fields["blockNumber"] = (*hexutil.Big)(b.block.Number())
+		fields["transactionIndex"] = hexutil.Uint64(index)
+		if tx.Type() == types.DynamicFeeTxType {
+			// 已打包的1559交易返回实际的gas price
+			fields["gasPrice"] = (*hexutil.Big)(new(big.Int).Add(b.block.BaseFee(), tx.EffectiveGasTipValue(b.block.BaseFee())))
+		}
+	} else {
+		fields["blockHash"] = nil
+		fields["blockNumber"] = nil
+		fields["transactionIndex"] = nil
+	}
+	if tx.Type() != types.LegacyTxType {
+		fields["chainId"] = (*hexutil.Big)(tx.ChainId())
+		fields["accessList"] = tx.AccessList()
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		fields["maxFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap())
+		fields["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasTipCap())
+	}
+	return fields
+}
+
+func marshalReceipt(lookup *txLookup) map[string]interface{} {
+	b := lookup.block
+	receipt := b.receipts[lookup.index]
+	tx := lookup.tx
+	price := new(big.Int).Add(b.block.BaseFee(), tx.EffectiveGasTipValue(b.block.BaseFee()))
+	fields := map[string]interface{}{
+		"type":              hexutil.Uint64(receipt.Type),
+		"status":            hexutil.Uint64(receipt.Status),
+		"transactionHash":   tx.Hash(),
+		"transactionIndex":  hexutil.Uint64(lookup.index),
+		"blockHash":         b.block.Hash(),
+		"blockNumber":       (*hexutil.Big)(b.block.Number()),
+		"from":              lookup.from,
+		"to":                tx.To(),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"effectiveGasPrice": (*hexutil.Big)(price),
+		"contractAddress":   nil,
+		"logs":              receipt.Logs,
+		"logsBloom":         receipt.Bloom,
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		fields["contractAddress"] = receipt.ContractAddress
+	}
+	return fields
+}
@@ -0,0 +1,526 @@
+package fakenode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const (
+	DefaultChainID   = 1337
+	DefaultGasLimit  = 30000000
+	DefaultBlockTime = 12
+	genesisTime      = 1600000000
+)
+
+var (
+	DefaultBaseFee   = big.NewInt(params.GWei)
+	DefaultGasTipCap = big.NewInt(params.GWei)
+	// DefaultCoinbase 出块地址，交易的矿工费转入该地址
+	DefaultCoinbase = common.HexToAddress("0x00000000000000000000000000000000000c0ffe")
+)
+
+var (
+	ErrNonceTooLow       = errors.New("nonce too low")
+	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+	ErrIntrinsicGas      = errors.New("intrinsic gas too low")
+	ErrFeeCapTooLow      = errors.New("max fee per gas less than block base fee")
+	ErrAlreadyKnown      = errors.New("already known")
+	ErrInvalidReorgDepth = errors.New("invalid reorg depth")
+)
+
+type Opt func(n *Node)
+
+// WithChainID 链ID，默认 1337
+func WithChainID(chainID int64) Opt {
+	return func(n *Node) {
+		n.chainID = big.NewInt(chainID)
+	}
+}
+
+// WithAlloc 创世区块中账户的初始余额
+func WithAlloc(alloc map[common.Address]*big.Int) Opt {
+	return func(n *Node) {
+		for addr, balance := range alloc {
+			n.alloc[addr] = new(big.Int).Set(balance)
+		}
+	}
+}
+
+// WithBaseFee 每个区块固定的base fee
+func WithBaseFee(baseFee *big.Int) Opt {
+	return func(n *Node) {
+		n.baseFee = baseFee
+	}
+}
+
+// WithAutoMine 每收到一笔交易立即出块
+func WithAutoMine() Opt {
+	return func(n *Node) {
+		n.autoMine = true
+	}
+}
+
+// WithFailingMethods 指定的方法返回错误，用于测试降级逻辑，支持 trace_block、debug_traceBlockByHash、debug_traceBlockByNumber
+func WithFailingMethods(methods ...string) Opt {
+	return func(n *Node) {
+		for _, method := range methods {
+			n.failing[method] = true
+		}
+	}
+}
+
+// Node 内存中的以太坊节点，通过本地http提供jsonrpc服务，供测试使用
+// 只处理转账，不执行EVM，eth_call 的结果需要通过 SetCallResult 预先设置
+type Node struct {
+	mu       sync.Mutex
+	chainID  *big.Int
+	signer   types.Signer
+	baseFee  *big.Int
+	autoMine bool
+	alloc    map[common.Address]*big.Int
+	forks    uint64
+	failing  map[string]bool
+
+	chain    []*minedBlock
+	byHash   map[common.Hash]*minedBlock
+	txs      map[common.Hash]*txLookup
+	pending  []*types.Transaction
+	calls    map[string][]byte
+	server   *rpc.Server
+	listener net.Listener
+	http     *http.Server
+}
+
+// minedBlock 区块及其交易回执、出块后的状态
+type minedBlock struct {
+	block    *types.Block
+	receipts []*types.Receipt
+	senders  []common.Address
+	state    *state
+}
+
+// txLookup 交易所在区块
+type txLookup struct {
+	tx    *types.Transaction
+	from  common.Address
+	block *minedBlock
+	index int
+}
+
+// New 创建节点并在 127.0.0.1 的随机端口上启动http服务
+func New(opts ...Opt) (*Node, error) {
+	n := &Node{
+		chainID: big.NewInt(DefaultChainID),
+		baseFee: DefaultBaseFee,
+		alloc:   make(map[common.Address]*big.Int),
+		byHash:  make(map[common.Hash]*minedBlock),
+		txs:     make(map[common.Hash]*txLookup),
+		calls:   make(map[string][]byte),
+		failing: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	n.signer = types.LatestSignerForChainID(n.chainID)
+	n.appendBlock(n.newBlock(nil, &state{balances: n.alloc, nonces: make(map[common.Address]uint64)}))
+
+	n.server = rpc.NewServer()
+	if err := n.server.RegisterName("eth", &ethAPI{n: n}); err != nil {
+		return nil, err
+	}
+	if err := n.server.RegisterName("trace", &traceAPI{n: n}); err != nil {
+		return nil, err
+	}
+	if err := n.server.RegisterName("debug", &debugAPI{n: n}); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	n.listener = listener
+	n.http = &http.Server{Handler: n.server}
+	go n.http.Serve(listener)
+	return n, nil
+}
+
+// fail 方法被指定返回错误
+func (n *Node) fail(method string) error {
+	if n.failing[method] {
+		return fmt.Errorf("%s failed", method)
+	}
+	return nil
+}
+
+// URL jsonrpc http地址
+func (n *Node) URL() string {
+	return "http://" + n.listener.Addr().String()
+}
+
+// ChainID 链ID
+func (n *Node) ChainID() *big.Int {
+	return new(big.Int).Set(n.chainID)
+}
+
+// Close 停止http服务
+func (n *Node) Close() error {
+	err := n.http.Close()
+	n.server.Stop()
+	return err
+}
+
+// Head 最新区块
+func (n *Node) Head() *types.Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.head().block
+}
+
+// BlockByNumber 主链上对应高度的区块
+func (n *Node) BlockByNumber(number uint64) *types.Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if number >= uint64(len(n.chain)) {
+		return nil
+	}
+	return n.chain[number].block
+}
+
+// Balance 最新区块的账户余额
+func (n *Node) Balance(addr common.Address) *big.Int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.head().state.balance(addr)
+}
+
+// PendingCount 交易池中等待打包的交易数
+func (n *Node) PendingCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.pending)
+}
+
+// SetCallResult 设置 eth_call 调用合约 to 时，calldata以data开头的返回值，data通常为方法selector
+func (n *Node) SetCallResult(to common.Address, data []byte, result []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls[callKey(to, data)] = common.CopyBytes(result)
+}
+
+// Mine 将交易池中可执行的交易打包出一个新区块
+func (n *Node) Mine() *types.Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.mine()
+}
+
+// MineN 连续出n个区块
+func (n *Node) MineN(count int) *types.Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var b *types.Block
+	for i := 0; i < count; i++ {
+		b = n.mine()
+	}
+	return b
+}
+
+// Reorg 回滚最新的depth个区块并在分叉上重新出 depth+1 个区块，被回滚区块中的交易重新打包进新的分叉
+func (n *Node) Reorg(depth int) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if depth <= 0 || depth >= len(n.chain) {
+		return fmt.Errorf("%w: %d, chain length %d", ErrInvalidReorgDepth, depth, len(n.chain))
+	}
+	var orphaned []*types.Transaction
+	for _, b := range n.chain[len(n.chain)-depth:] {
+		for _, tx := range b.block.Transactions() {
+			delete(n.txs, tx.Hash())
+			orphaned = append(orphaned, tx)
+		}
+	}
+	n.chain = n.chain[:len(n.chain)-depth]
+	n.pending = append(orphaned, n.pending...)
+	n.forks++
+	for i := 0; i <= depth; i++ {
+		n.mine()
+	}
+	return nil
+}
+
+// SendTransaction 将签名交易加入交易池
+func (n *Node) SendTransaction(tx *types.Transaction) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.addTx(tx); err != nil {
+		return err
+	}
+	if n.autoMine {
+		n.mine()
+	}
+	return nil
+}
+
+func (n *Node) head() *minedBlock {
+	return n.chain[len(n.chain)-1]
+}
+
+func (n *Node) addTx(tx *types.Transaction) error {
+	if _, ok := n.txs[tx.Hash()]; ok {
+		return ErrAlreadyKnown
+	}
+	for _, pending := range n.pending {
+		if pending.Hash() == tx.Hash() {
+			return ErrAlreadyKnown
+		}
+	}
+	from, err := types.Sender(n.signer, tx)
+	if err != nil {
+		return err
+	}
+	pending := n.pendingState()
+	if tx.Nonce() < pending.nonces[from] {
+		return fmt.Errorf("%w: address %s, tx: %d state: %d", ErrNonceTooLow, from, tx.Nonce(), pending.nonces[from])
+	}
+	if err = n.validate(tx, from, n.head().state); err != nil && !errors.Is(err, ErrNonceTooLow) {
+		return err
+	}
+	n.pending = append(n.pending, tx)
+	return nil
+}
+
+// validate 交易能否在state之上执行
+func (n *Node) validate(tx *types.Transaction, from common.Address, s *state) error {
+	if tx.Nonce() < s.nonces[from] {
+		return ErrNonceTooLow
+	}
+	if tx.GasFeeCap().Cmp(n.baseFee) < 0 {
+		return fmt.Errorf("%w: address %s, maxFeePerGas: %s baseFee: %s", ErrFeeCapTooLow, from, tx.GasFeeCap(), n.baseFee)
+	}
+	gas, err := intrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil)
+	if err != nil {
+		return err
+	}
+	if tx.Gas() < gas {
+		return fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, tx.Gas(), gas)
+	}
+	cost := new(big.Int).Mul(tx.GasFeeCap(), new(big.Int).SetUint64(tx.Gas()))
+	cost.Add(cost, tx.Value())
+	if s.balance(from).Cmp(cost) < 0 {
+		return fmt.Errorf("%w: address %s have %s want %s", ErrInsufficientFunds, from, s.balance(from), cost)
+	}
+	return nil
+}
+
+// pendingState 最新状态叠加交易池中的交易后的nonce
+func (n *Node) pendingState() *state {
+	s := n.head().state.copy()
+	for _, tx := range n.pending {
+		from, _ := types.Sender(n.signer, tx)
+		if tx.Nonce() == s.nonces[from] {
+			s.nonces[from]++
+		}
+	}
+	return s
+}
+
+// mine 按交易池顺序执行nonce连续的交易，nonce过低或者余额不足的交易被丢弃，nonce不连续的交易留在交易池
+func (n *Node) mine() *types.Block {
+	parent := n.head()
+	s := parent.state.copy()
+	var (
+		included []*types.Transaction
+		receipts []*types.Receipt
+		senders  []common.Address
+		gasUsed  uint64
+		remains  []*types.Transaction
+	)
+	for progress := true; progress; {
+		progress = false
+		remains = remains[:0]
+		for _, tx := range n.pending {
+			from, _ := types.Sender(n.signer, tx)
+			if tx.Nonce() > s.nonces[from] {
+				remains = append(remains, tx)
+				continue
+			}
+			if err := n.validate(tx, from, s); err != nil {
+				continue
+			}
+			used, _ := intrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil)
+			gasUsed += used
+			receipts = append(receipts, s.apply(tx, from, used, n.baseFee, gasUsed, len(included)))
+			included = append(included, tx)
+			senders = append(senders, from)
+			progress = true
+		}
+		n.pending = append([]*types.Transaction(nil), remains...)
+	}
+	b := n.newBlock(parent, s)
+	header := b.block.Header()
+	header.GasUsed = gasUsed
+	b.block = types.NewBlock(header, included, nil, receipts, new(listHasher))
+	b.receipts = receipts
+	b.senders = senders
+	n.appendBlock(b)
+	return b.block
+}
+
+// newBlock 在parent之上创建一个空区块，分叉次数写入extra保证分叉上的区块hash不同
+func (n *Node) newBlock(parent *minedBlock, s *state) *minedBlock {
+	header := &types.Header{
+		ParentHash:  common.Hash{},
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    DefaultCoinbase,
+		Root:        s.root(),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  big.NewInt(1),
+		Number:      big.NewInt(0),
+		GasLimit:    DefaultGasLimit,
+		Time:        genesisTime,
+		Extra:       new(big.Int).SetUint64(n.forks).Bytes(),
+		BaseFee:     new(big.Int).Set(n.baseFee),
+	}
+	if parent != nil {
+		header.ParentHash = parent.block.Hash()
+		header.Number = new(big.Int).Add(parent.block.Number(), common.Big1)
+		header.Time = parent.block.Time() + DefaultBlockTime
+	}
+	return &minedBlock{block: types.NewBlockWithHeader(header), state: s}
+}
+
+func (n *Node) appendBlock(b *minedBlock) {
+	n.chain = append(n.chain, b)
+	n.byHash[b.block.Hash()] = b
+	for idx, tx := range b.block.Transactions() {
+		n.txs[tx.Hash()] = &txLookup{tx: tx, from: b.senders[idx], block: b, index: idx}
+	}
+	header := b.block.Header()
+	for idx, receipt := range b.receipts {
+		receipt.BlockHash = b.block.Hash()
+		receipt.BlockNumber = header.Number
+		receipt.TransactionIndex = uint(idx)
+	}
+}
+
+// state 账户余额及nonce
+type state struct {
+	balances map[common.Address]*big.Int
+	nonces   map[common.Address]uint64
+}
+
+func (s *state) copy() *state {
+	cpy := &state{balances: make(map[common.Address]*big.Int, len(s.balances)), nonces: make(map[common.Address]uint64, len(s.nonces))}
+	for addr, balance := range s.balances {
+		cpy.balances[addr] = new(big.Int).Set(balance)
+	}
+	for addr, nonce := range s.nonces {
+		cpy.nonces[addr] = nonce
+	}
+	return cpy
+}
+
+func (s *state) balance(addr common.Address) *big.Int {
+	if balance, ok := s.balances[addr]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return new(big.Int)
+}
+
+func (s *state) add(addr common.Address, amount *big.Int) {
+	s.balances[addr] = new(big.Int).Add(s.balance(addr), amount)
+}
+
+// apply 执行一笔转账，base fee 被销毁，小费转给出块地址
+func (s *state) apply(tx *types.Transaction, from common.Address, gasUsed uint64, baseFee *big.Int, cumulativeGasUsed uint64, index int) *types.Receipt {
+	tip := tx.EffectiveGasTipValue(baseFee)
+	price := new(big.Int).Add(baseFee, tip)
+	fee := new(big.Int).Mul(price, new(big.Int).SetUint64(gasUsed))
+	s.add(from, new(big.Int).Neg(new(big.Int).Add(fee, tx.Value())))
+	s.add(DefaultCoinbase, new(big.Int).Mul(tip, new(big.Int).SetUint64(gasUsed)))
+
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: cumulativeGasUsed,
+		TxHash:            tx.Hash(),
+		GasUsed:           gasUsed,
+		Logs:              []*types.Log{},
+		TransactionIndex:  uint(index),
+	}
+	if tx.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(from, tx.Nonce())
+	} else {
+		s.add(*tx.To(), tx.Value())
+	}
+	s.nonces[from]++
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	return receipt
+}
+
+// root 状态的摘要，用作区块的stateRoot
+func (s *state) root() common.Hash {
+	hasher := new(listHasher)
+	for addr, balance := range s.balances {
+		hasher.Update(addr.Bytes(), balance.Bytes())
+	}
+	return hasher.Hash()
+}
+
+// listHasher 对所有元素做keccak，结果与真正的trie根不同，只用于生成确定的区块字段
+type listHasher struct {
+	items [][]byte
+}
+
+func (h *listHasher) Reset() {
+	h.items = h.items[:0]
+}
+
+func (h *listHasher) Update(key []byte, value []byte) {
+	h.items = append(h.items, append(common.CopyBytes(key), value...))
+}
+
+func (h *listHasher) Hash() common.Hash {
+	if len(h.items) == 0 {
+		return types.EmptyRootHash
+	}
+	// 状态按map顺序写入，排序保证结果确定
+	sort.Slice(h.items, func(i, j int) bool {
+		return bytes.Compare(h.items[i], h.items[j]) < 0
+	})
+	return crypto.Keccak256Hash(h.items...)
+}
+
+// intrinsicGas 交易的固定gas消耗
+func intrinsicGas(data []byte, accessList types.AccessList, isCreate bool) (uint64, error) {
+	gas := params.TxGas
+	if isCreate {
+		gas = params.TxGasContractCreation
+	}
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	gas += uint64(len(accessList)) * params.TxAccessListAddressGas
+	gas += uint64(accessList.StorageKeys()) * params.TxAccessListStorageKeyGas
+	return gas, nil
+}
+
+func callKey(to common.Address, data []byte) string {
+	return to.Hex() + common.Bytes2Hex(data)
+}
@@ -0,0 +1,230 @@
+package fakenode_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/client/fakenode"
+	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/polling"
+	"github.com/taorzhang/toolkit/types/block"
+	"github.com/taorzhang/toolkit/wallet"
+	"math/big"
+	"testing"
+)
+
+func newNode(t *testing.T, opts ...fakenode.Opt) (*fakenode.Node, client.Provider, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	alloc := map[common.Address]*big.Int{crypto.PubkeyToAddress(key.PublicKey): big.NewInt(1e18)}
+	node, err := fakenode.New(append(opts, fakenode.WithAlloc(alloc))...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = node.Close() })
+	rpcClient, err := jsonrpc.NewClient(jsonrpc.GetDefaultOpts(node.URL())...)
+	assert.NoError(t, err)
+	t.Cleanup(rpcClient.Release)
+	return node, client.NewEthClient(rpcClient, rpcClient), key
+}
+
+func TestNode_transfer(t *testing.T) {
+	ctx := context.Background()
+	node, eth, key := newNode(t)
+	account := &wallet.Account{PrivateKey: key, Client: eth}
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000aa")
+
+	hash, err := account.SendNativeToken(to, big.NewInt(1000))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, node.PendingCount())
+	nonce, err := account.GetNonce(wallet.Pending)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), nonce)
+
+	mined := node.Mine()
+	assert.Equal(t, uint64(1), mined.NumberU64())
+	head, err := eth.BlockNumber(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), head)
+
+	balance, err := eth.BalanceAt(ctx, to)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), balance.Int64())
+
+	b, err := eth.BlockByNumber(ctx, head, true)
+	assert.NoError(t, err)
+	assert.Equal(t, mined.Hash().Bytes(), b.Hash.Bytes())
+	assert.Len(t, b.Transactions, 1)
+	assert.Equal(t, *hash, b.Transactions[0].Hash)
+	assert.Equal(t, uint64(1), uint64(b.Transactions[0].Receipt.Status))
+	assert.Equal(t, uint64(21000), uint64(b.Transactions[0].Receipt.GasUsed))
+
+	// 无法解析的交易
+	_, err = eth.SendTx(ctx, "0x00")
+	assert.Error(t, err)
+}
+
+func TestNode_reorg(t *testing.T) {
+	ctx := context.Background()
+	node, eth, key := newNode(t, fakenode.WithAutoMine())
+	account := &wallet.Account{PrivateKey: key, Client: eth}
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000bb")
+	hash, err := account.SendNativeToken(to, big.NewInt(1))
+	assert.NoError(t, err)
+	node.MineN(2)
+
+	before, err := eth.BlockByNumber(ctx, 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, node.Reorg(3))
+	after, err := eth.BlockByNumber(ctx, 1, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, before.Hash, after.Hash)
+	assert.Equal(t, before.TransactionsHashes, after.TransactionsHashes)
+
+	head, err := eth.BlockNumber(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), head)
+	tx, err := eth.TransactionByHash(ctx, *hash, true)
+	assert.NoError(t, err)
+	assert.Equal(t, after.Hash, tx.Receipt.BlockHash)
+
+	// 旧分叉上的区块仍然可以按hash查询
+	orphaned, err := eth.BlockByHash(ctx, before.Hash, false)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Hash, orphaned.Hash)
+}
+
+func TestNode_pollingItem(t *testing.T) {
+	node, eth, key := newNode(t)
+	account := &wallet.Account{PrivateKey: key, Client: eth}
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000cc")
+	hash, err := account.SendNativeToken(to, big.NewInt(7))
+	assert.NoError(t, err)
+	node.MineN(3)
+
+	item := polling.NewItem(context.Background(), eth, 1, 4, true, client.ErigonType)
+	assert.NoError(t, item.Retrieve())
+	internalTxs, err := eth.InternalTxs(context.Background(), []block.Hash{*hash}, client.ErigonType)
+	assert.NoError(t, err)
+	assert.Len(t, internalTxs[hash.String()], 1)
+	assert.Equal(t, int64(7), internalTxs[hash.String()][0].Value.ToBigInt().Int64())
+
+	// 按区块追踪，结果写入区块中的交易
+	for _, clientType := range []client.EthClientType{client.ErigonType, client.GethType} {
+		item = polling.NewItem(context.Background(), eth, 1, 4, false, clientType)
+		assert.NoError(t, item.Retrieve())
+		traced := 0
+		for _, b := range item.Blocks() {
+			for _, tx := range b.Transactions {
+				assert.Equal(t, *hash, tx.Hash)
+				assert.Len(t, tx.InternalTraceCalls, 1)
+				assert.Equal(t, uint64(b.Number), tx.InternalTraceCalls[0].BlockNumber)
+				assert.Equal(t, int64(7), tx.InternalTraceCalls[0].Value.ToBigInt().Int64())
+				traced++
+			}
+		}
+		assert.Equal(t, 1, traced, clientType)
+	}
+
+	// 只保留合约创建时转账被过滤
+	item = polling.NewItem(context.Background(), eth, 1, 4, false, client.GethType, polling.WithItemTraceFilter(block.Creations))
+	assert.NoError(t, item.Retrieve())
+	for _, b := range item.Blocks() {
+		for _, tx := range b.Transactions {
+			assert.Empty(t, tx.InternalTraceCalls)
+		}
+	}
+
+	internalTxs, err = eth.InternalTxs(context.Background(), []block.Hash{*hash}, client.GethType)
+	assert.NoError(t, err)
+	assert.Len(t, internalTxs[hash.String()], 1)
+	trace := internalTxs[hash.String()][0]
+	mined := node.BlockByNumber(1)
+	assert.Equal(t, uint64(1), trace.BlockNumber)
+	assert.Equal(t, mined.Hash().Bytes(), trace.BlockHash.Bytes())
+	assert.Equal(t, "call", trace.CallType)
+	assert.Equal(t, 0, trace.Depth)
+	assert.Equal(t, uint64(21000), trace.GasUsed)
+	assert.Equal(t, int64(7), trace.Value.ToBigInt().Int64())
+}
+
+func TestNode_pollingCreate(t *testing.T) {
+	node, eth, key := newNode(t)
+	gasPrice := new(big.Int).Mul(node.Head().BaseFee(), big.NewInt(2))
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Gas: 100000, GasPrice: gasPrice, Data: []byte{0x60, 0x00}}), types.LatestSignerForChainID(node.ChainID()), key)
+	assert.NoError(t, err)
+	assert.NoError(t, node.SendTransaction(tx))
+	node.Mine()
+
+	// 默认保留不带value的合约创建
+	for _, clientType := range []client.EthClientType{client.ErigonType, client.GethType} {
+		item := polling.NewItem(context.Background(), eth, 1, 2, false, clientType)
+		assert.NoError(t, item.Retrieve())
+		assert.Len(t, item.Blocks(), 1)
+		traces := item.Blocks()[0].Transactions[0].InternalTraceCalls
+		assert.Len(t, traces, 1, clientType)
+		assert.Equal(t, crypto.CreateAddress(crypto.PubkeyToAddress(key.PublicKey), 0).Bytes(), traces[0].ContractAddress.Bytes(), clientType)
+	}
+}
+
+func TestNode_traceBlocksReorg(t *testing.T) {
+	ctx := context.Background()
+	node, eth, key := newNode(t)
+	account := &wallet.Account{PrivateKey: key, Client: eth}
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000dd")
+	_, err := account.SendNativeToken(to, big.NewInt(3))
+	assert.NoError(t, err)
+	node.MineN(2)
+
+	stale, err := eth.BlockByNumber(ctx, 1, true)
+	assert.NoError(t, err)
+	assert.NoError(t, node.Reorg(2))
+
+	// trace_block 只能按高度查询，返回的是新分叉上的区块
+	err = eth.TraceBlocks(ctx, []*block.Block{stale}, client.ErigonType)
+	assert.ErrorIs(t, err, errs.BlockHashMismatch)
+	// debug_traceBlockByHash 追踪的仍是旧分叉上的区块
+	assert.NoError(t, eth.TraceBlocks(ctx, []*block.Block{stale}, client.GethType))
+	assert.Len(t, stale.Transactions[0].InternalTraceCalls, 1)
+
+	assert.Equal(t, stale.Hash.Bytes(), stale.Transactions[0].InternalTraceCalls[0].BlockHash.Bytes())
+}
+
+func TestNode_traceBlocksFallback(t *testing.T) {
+	ctx := context.Background()
+	node, eth, key := newNode(t, fakenode.WithFailingMethods("trace_block", "debug_traceBlockByHash"))
+	account := &wallet.Account{PrivateKey: key, Client: eth}
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000ee")
+	_, err := account.SendNativeToken(to, big.NewInt(5))
+	assert.NoError(t, err)
+	node.Mine()
+
+	// 区块追踪失败时按交易追踪
+	for _, clientType := range []client.EthClientType{client.ErigonType, client.GethType} {
+		b, err := eth.BlockByNumber(ctx, 1, true)
+		assert.NoError(t, err)
+		assert.NoError(t, eth.TraceBlocks(ctx, []*block.Block{b}, clientType))
+		assert.Len(t, b.Transactions[0].InternalTraceCalls, 1, clientType)
+		trace := b.Transactions[0].InternalTraceCalls[0]
+		assert.Equal(t, int64(5), trace.Value.ToBigInt().Int64())
+		assert.Equal(t, uint64(1), trace.BlockNumber)
+		assert.Equal(t, b.Hash.Bytes(), trace.BlockHash.Bytes())
+	}
+}
+
+func TestNode_call(t *testing.T) {
+	node, eth, _ := newNode(t)
+	token := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	node.SetCallResult(token, common.FromHex("0x313ce567"), common.LeftPadBytes([]byte{18}, 32))
+
+	var decimals string
+	err := eth.MethodCall(context.Background(), &decimals, client.CallParameter{
+		To:   &token,
+		Data: common.FromHex("0x313ce567"),
+	}.ToArg(), "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(18), new(big.Int).SetBytes(common.FromHex(decimals)).Int64())
+}
@@ -1,94 +1,413 @@
 package jsonrpc
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/logs"
 	"sync"
+	"time"
 )
 
 var (
-	GroupSize = 50
-	ReTries   = 3
+	log = logs.NewLogger("module", "jsonrpc")
 )
 
 type Client struct {
-	pool *Pool
+	endpoints []*endpoint
+	router    *router
+	hedger    *hedger
+	cfg       *ClientCfg
+	quit      chan struct{}
+	closeOnce sync.Once
 }
 
+// NewClient 单节点client
 func NewClient(opts ...PoolCfgOpt) (*Client, error) {
-	newPool, err := NewPool(opts...)
-	return &Client{pool: newPool}, err
+	return NewFailoverClient([]Endpoint{{Weight: 1, Opts: opts}})
+}
+
+// NewFailoverClient 多节点client，按节点健康状况选择节点，节点不可用时自动切换
+func NewFailoverClient(endpoints []Endpoint, opts ...ClientOpt) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errs.New(errs.InvalidParams, "endpoints is empty")
+	}
+	cfg := newClientCfg()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	c := &Client{cfg: cfg, quit: make(chan struct{})}
+	for idx := range endpoints {
+		e, err := newEndpoint(endpoints[idx], cfg)
+		if err != nil {
+			c.Release()
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, e)
+	}
+	router, err := newRouter(cfg.routes, c.endpoints)
+	if err != nil {
+		c.Release()
+		return nil, err
+	}
+	c.router = router
+	if cfg.hedgePolicy != nil {
+		c.hedger = newHedger(*cfg.hedgePolicy)
+	}
+	if err = c.verifyChain(); err != nil {
+		c.Release()
+		return nil, err
+	}
+	if (len(c.endpoints) > 1 || c.chainChecked()) && cfg.healthCheckInterval > 0 {
+		go c.healthCheck()
+	}
+	return c, nil
+}
+
+// chainChecked 是否有节点需要校验链id
+func (c *Client) chainChecked() bool {
+	for _, e := range c.endpoints {
+		if e.pool.chainID != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyChain 创建时校验节点的链id，不一致时返回错误，节点不可达时等探活时再校验
+func (c *Client) verifyChain() error {
+	for _, e := range c.endpoints {
+		if e.pool.chainID == 0 {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.cfg.healthCheckTimeout)
+		err := e.verifyChain(ctx)
+		cancel()
+		if errors.Is(err, errs.ChainIDMismatch) {
+			return err
+		}
+		if err != nil {
+			log.Warn(ctx, "verify endpoint chain id failed, endpoint is unused until verified", "endpoint", e.name, "err", err)
+		}
+	}
+	return nil
 }
 
 func (c *Client) Release() {
-	c.pool.Release()
+	c.closeOnce.Do(func() {
+		close(c.quit)
+		for _, e := range c.endpoints {
+			e.pool.Release()
+		}
+	})
 }
 
-// Call 单独call
+// EndpointStats 各节点的健康状态
+func (c *Client) EndpointStats() []EndpointStat {
+	stats := make([]EndpointStat, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		stats = append(stats, e.stat())
+	}
+	return stats
+}
+
+// Call 单独call，超时为 WithCallTimeout
+//
+// Deprecated: 重试及限流等待无法取消，使用 CallContext
 func (c *Client) Call(method string, out interface{}, args ...interface{}) error {
-	return c.pool.Run(func(client *rpc.Client) error {
-		return client.Call(out, method, args...)
+	ctx, cancel := c.callContext()
+	defer cancel()
+	return c.CallContext(ctx, method, out, args...)
+}
+
+// callContext 不带ctx的请求使用client的超时
+func (c *Client) callContext() (context.Context, context.CancelFunc) {
+	if c.cfg.callTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.cfg.callTimeout)
+}
+
+// CallContext 单独call，ctx取消或超时后立即返回
+func (c *Client) CallContext(ctx context.Context, method string, out interface{}, args ...interface{}) error {
+	endpoints := supporting(c.router.endpoints(c.router.route(method, args, c.head())), method)
+	err := c.retry(ctx, method, func(attempt int) error {
+		call := func(ctx context.Context, e *endpoint, out interface{}) error {
+			spanCtx, span := c.startCallSpan(ctx, e, method, attempt)
+			start := time.Now()
+			err := e.call(spanCtx, method, out, args...)
+			observeCall(e, method, time.Since(start), err)
+			endSpan(span, err, nil)
+			if isMethodNotFound(err) {
+				e.markUnsupported(ctx, method)
+			}
+			return err
+		}
+		if c.hedger != nil && c.hedger.allowed(method) {
+			return c.hedge(ctx, method, endpoints, out, call)
+		}
+		return c.failover(ctx, endpoints, func(e *endpoint) error {
+			return call(ctx, e, out)
+		})
 	})
+	return errs.Classify(err)
 }
 
-// BatchCall 批量rpc请求，当批量数过多，会进行分组
+// BatchCall 批量rpc请求，当批量数过多，会进行分组，超时为 WithCallTimeout
+//
+// Deprecated: 重试及限流等待无法取消，使用 BatchCallContext
 func (c *Client) BatchCall(elems []rpc.BatchElem, allOk bool) error {
+	ctx, cancel := c.callContext()
+	defer cancel()
+	return c.BatchCallContext(ctx, elems, allOk)
+}
+
+// BatchCallContext 批量rpc请求，只重试失败且可重试的元素
+// allOk 为true时任一元素失败都返回 *BatchError，否则只有元素未得到节点响应时才返回
+func (c *Client) BatchCallContext(ctx context.Context, elems []rpc.BatchElem, allOk bool) error {
 	if len(elems) == 0 {
 		return nil
 	}
+	policy := c.cfg.retryPolicy
+	pending := make([]int, len(elems))
+	for idx := range pending {
+		pending[idx] = idx
+	}
+	attempt := 1
+	for ; ; attempt++ {
+		batch := make([]rpc.BatchElem, len(pending))
+		for i, idx := range pending {
+			batch[i] = elems[idx]
+			batch[i].Error = nil
+		}
+		c.batchCall(ctx, batch, attempt)
+		var lastErr error
+		retries := make([]int, 0)
+		for i, idx := range pending {
+			elems[idx].Error = batch[i].Error
+			if batch[i].Error != nil && policy.retryable(batch[i].Error) {
+				retries = append(retries, idx)
+				lastErr = batch[i].Error
+			}
+		}
+		if len(retries) == 0 || attempt >= policy.MaxAttempts {
+			break
+		}
+		if err := policy.wait(ctx, attempt, lastErr); err != nil {
+			return err
+		}
+		for _, idx := range retries {
+			retriesTotal.WithLabelValues(elems[idx].Method).Inc()
+		}
+		pending = retries
+	}
+	batchErr := &BatchError{Attempts: attempt, Causes: make(map[int]error)}
+	for idx := range elems {
+		if elems[idx].Error == nil {
+			continue
+		}
+		transportErr := isTransportError(elems[idx].Error)
+		elems[idx].Error = errs.Classify(elems[idx].Error)
+		if allOk || transportErr {
+			batchErr.Causes[idx] = elems[idx].Error
+		}
+	}
+	if len(batchErr.Causes) == 0 {
+		return nil
+	}
+	return batchErr
+}
 
-	if allOk {
-		for i := 0; i < ReTries; i++ {
-			if err := c.batchCall(elems, true); err == nil {
-				return nil
+// batchCall 按路由拆分后分组并发请求，分组请求失败时该组所有元素的 Error 均为该错误
+func (c *Client) batchCall(ctx context.Context, elems []rpc.BatchElem, attempt int) {
+	type segment struct {
+		endpoints []*endpoint
+		batch     []rpc.BatchElem
+	}
+	routed := c.router.split(elems, c.head())
+	segments := make([]segment, 0)
+	for _, r := range routed {
+		for _, batch := range explodeBySize(r.batch, int64(c.cfg.groupSize)) {
+			segments = append(segments, segment{endpoints: supporting(r.endpoints, batchMethods(batch)...), batch: batch})
+		}
+	}
+	defer func() {
+		// 结果通过Result指针写入，只需要拷回Error
+		for _, r := range routed {
+			for i, idx := range r.idx {
+				elems[idx].Error = r.batch[i].Error
 			}
+		}
+	}()
+	concurrency := c.cfg.maxConcurrency
+	if concurrency <= 0 || concurrency > len(segments) {
+		concurrency = len(segments)
+	}
+	limitCh := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, s := range segments {
+		wg.Add(1)
+		limitCh <- struct{}{}
+		go func(endpoints []*endpoint, batch []rpc.BatchElem) {
+			defer func() {
+				<-limitCh
+				wg.Done()
+			}()
+			err := c.failover(ctx, endpoints, func(e *endpoint) error {
+				spanCtx, span := c.startBatchSpan(ctx, e, batch, attempt)
+				start := time.Now()
+				err := e.batchCall(spanCtx, batch)
+				observeBatch(e, batch, time.Since(start), err)
+				endSpan(span, err, batch)
+				for idx := range batch {
+					if err == nil && isMethodNotFound(batch[idx].Error) {
+						e.markUnsupported(ctx, batch[idx].Method)
+					}
+				}
+				return err
+			})
+			if err != nil {
+				for idx := range batch {
+					batch[idx].Error = err
+				}
+			}
+		}(s.endpoints, s.batch)
+	}
+	wg.Wait()
+}
 
+// retry 按重试策略重试单个请求，非幂等方法不重试
+func (c *Client) retry(ctx context.Context, method string, runnable func(attempt int) error) (err error) {
+	policy := c.cfg.retryPolicy
+	for attempt := 1; ; attempt++ {
+		err = runnable(attempt)
+		if err == nil || nonRetryableMethods[method] || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return err
+		}
+		if policy.wait(ctx, attempt, err) != nil {
+			return err
 		}
-		return errs.New(errs.MaxRetryPollingBatchCall, fmt.Sprintf("retries %d", ReTries))
+		retriesTotal.WithLabelValues(method).Inc()
 	}
-	return c.batchCall(elems, allOk)
 }
 
-func (c *Client) batchCall(elems []rpc.BatchElem, allOk bool) error {
-	if len(elems) == 0 {
-		return nil
+// Supports 是否有节点可能支持该方法，所有节点都返回过方法不存在时为false
+func (c *Client) Supports(method string) bool {
+	for _, e := range c.router.endpoints(c.router.route(method, nil, 0)) {
+		if e.supports(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// failover 依次尝试各节点，直到请求成功或节点返回jsonrpc错误，节点不支持该方法时也尝试下一个节点
+func (c *Client) failover(ctx context.Context, endpoints []*endpoint, runnable func(e *endpoint) error) (err error) {
+	endpoints = orderEndpoints(endpoints)
+	if len(endpoints) == 0 {
+		return errChainIDMismatch()
+	}
+	for _, e := range endpoints {
+		start := time.Now()
+		err = runnable(e)
+		if ctx.Err() != nil {
+			// 调用方放弃的请求不计入节点错误率
+			return err
+		}
+		failed := isTransportError(err)
+		e.observe(time.Since(start), failed, c.cfg)
+		if !failed && !isMethodNotFound(err) {
+			return err
+		}
+		log.Warn(ctx, "endpoint request failed, try next endpoint", "endpoint", e.name, "err", err)
+	}
+	return err
+}
+
+// errChainIDMismatch 所有节点的链id都不一致或尚未校验
+func errChainIDMismatch() error {
+	return errs.New(errs.ChainIDMismatch, "no endpoint serving the expected chain")
+}
+
+// head 探活得到的最新高度，未探活时为0
+func (c *Client) head() uint64 {
+	var head uint64
+	for _, e := range c.endpoints {
+		e.mu.RLock()
+		if e.head > head {
+			head = e.head
+		}
+		e.mu.RUnlock()
 	}
-	segments := explodeBySize(elems, int64(GroupSize))
+	return head
+}
+
+// isTransportError 节点不可达、http状态码异常等错误，节点已正常返回的jsonrpc错误不计入
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+// healthCheck 定期探测节点高度，摘除高度落后的节点
+func (c *Client) healthCheck() {
+	ticker := time.NewTicker(c.cfg.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		c.probe()
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) probe() {
 	var wg sync.WaitGroup
-	groupErrs := make([]error, len(elems)/GroupSize+1)
-	for idx, segment := range segments {
+	for _, e := range c.endpoints {
 		wg.Add(1)
-		go func(idx int, batch []rpc.BatchElem) {
+		go func(e *endpoint) {
 			defer wg.Done()
-			client, err := c.pool.GetClient()
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.healthCheckTimeout)
+			defer cancel()
+			var head math.HexOrDecimal64
+			start := time.Now()
+			err := e.call(ctx, "eth_blockNumber", &head)
+			e.observe(time.Since(start), err != nil, c.cfg)
 			if err != nil {
+				log.Warn(ctx, "endpoint health check failed", "endpoint", e.name, "err", err)
 				return
 			}
-			defer c.pool.PutClient(client)
-			groupErrs[idx] = client.BatchCall(batch)
-		}(idx, segment)
+			e.setHead(uint64(head))
+			if e.pool.chainID != 0 {
+				if err = e.verifyChain(ctx); err != nil {
+					log.Error(ctx, "endpoint chain id check failed", "endpoint", e.name, "err", err)
+				}
+			}
+		}(e)
 	}
 	wg.Wait()
-	for idx := range groupErrs {
-		if groupErrs[idx] != nil {
-			return groupErrs[idx]
+	var maxHead uint64
+	for _, e := range c.endpoints {
+		if head := e.stat().Head; head > maxHead {
+			maxHead = head
 		}
 	}
-	if allOk {
-		for idx := range elems {
-			if elems[idx].Error != nil {
-				return elems[idx].Error
-			}
-		}
+	for _, e := range c.endpoints {
+		e.setLagging(e.stat().Head+c.cfg.maxBlockLag < maxHead)
 	}
-	return nil
 }
 
+// explodeBySize 按groupSize分组，groupSize<=0 时不分组
 func explodeBySize[T any](arr []T, groupSize int64) [][]T {
 	var segments = make([][]T, 0)
 	elemNumbers := int64(len(arr))
-	if elemNumbers < groupSize {
+	if groupSize <= 0 || elemNumbers < groupSize {
 		segments = append(segments, arr)
 		return segments
 	}
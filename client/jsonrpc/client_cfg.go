@@ -0,0 +1,143 @@
+package jsonrpc
+
+import (
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const (
+	DefaultGroupSize           = 50
+	DefaultRetries             = 3
+	DefaultMaxConcurrency      = 16
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 3 * time.Second
+	DefaultMaxErrorRate        = 0.5
+	DefaultMaxBlockLag         = 10
+	DefaultEjectDuration       = 30 * time.Second
+	DefaultCallTimeout         = time.Minute
+)
+
+// GroupSize ReTries 创建client时的默认分组大小及请求次数
+//
+// Deprecated: 使用 WithGroupSize、WithRetries
+var (
+	GroupSize = DefaultGroupSize
+	ReTries   = DefaultRetries
+)
+
+// ClientCfg client级别的配置，对所有节点生效
+type ClientCfg struct {
+	// groupSize 批量请求的分组大小，节点拒绝时按节点自动缩小
+	groupSize int
+	// maxConcurrency 批量请求分组后最多同时发送的分组数
+	maxConcurrency int
+	// healthCheckInterval 节点探活间隔，<=0 时不探活
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	// maxErrorRate 节点错误率超过该值时被摘除
+	maxErrorRate float64
+	// maxBlockLag 节点高度落后最高节点超过该值时被摘除
+	maxBlockLag uint64
+	// ejectDuration 节点被摘除的时长
+	ejectDuration time.Duration
+	retryPolicy   RetryPolicy
+	// tracerProvider 为空时使用 otel 全局的 TracerProvider
+	tracerProvider trace.TracerProvider
+	routes         []Route
+	// hedgePolicy 为空时不对冲
+	hedgePolicy *HedgePolicy
+	// callTimeout 不带ctx的 Call、BatchCall 的超时，<=0 时不限制
+	callTimeout time.Duration
+}
+
+func newClientCfg() *ClientCfg {
+	c := &ClientCfg{
+		groupSize:           DefaultGroupSize,
+		maxConcurrency:      DefaultMaxConcurrency,
+		healthCheckInterval: DefaultHealthCheckInterval,
+		healthCheckTimeout:  DefaultHealthCheckTimeout,
+		maxErrorRate:        DefaultMaxErrorRate,
+		maxBlockLag:         DefaultMaxBlockLag,
+		ejectDuration:       DefaultEjectDuration,
+		retryPolicy:         DefaultRetryPolicy(),
+		callTimeout:         DefaultCallTimeout,
+	}
+	// 兼容修改了 GroupSize 的调用方
+	WithGroupSize(GroupSize)(c)
+	return c
+}
+
+type ClientOpt func(c *ClientCfg)
+
+// WithHealthCheck 节点探活间隔及单次探活超时
+func WithHealthCheck(interval, timeout time.Duration) ClientOpt {
+	return func(c *ClientCfg) {
+		c.healthCheckInterval = interval
+		c.healthCheckTimeout = timeout
+	}
+}
+
+// WithCallTimeout 不带ctx的 Call、BatchCall 的超时(包括重试及限流等待)，<=0 时不限制
+func WithCallTimeout(timeout time.Duration) ClientOpt {
+	return func(c *ClientCfg) {
+		c.callTimeout = timeout
+	}
+}
+
+// WithMaxErrorRate 节点错误率(0~1)阈值
+func WithMaxErrorRate(rate float64) ClientOpt {
+	return func(c *ClientCfg) {
+		c.maxErrorRate = rate
+	}
+}
+
+// WithMaxBlockLag 节点允许落后的区块数
+func WithMaxBlockLag(lag uint64) ClientOpt {
+	return func(c *ClientCfg) {
+		c.maxBlockLag = lag
+	}
+}
+
+// WithEjectDuration 节点被摘除后多久重新参与选择
+func WithEjectDuration(t time.Duration) ClientOpt {
+	return func(c *ClientCfg) {
+		c.ejectDuration = t
+	}
+}
+
+// WithRetryPolicy 请求失败后的重试策略
+func WithRetryPolicy(policy RetryPolicy) ClientOpt {
+	return func(c *ClientCfg) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithGroupSize 批量请求的分组大小，<=0 时忽略
+func WithGroupSize(size int) ClientOpt {
+	return func(c *ClientCfg) {
+		if size > 0 {
+			c.groupSize = size
+		}
+	}
+}
+
+// WithRetries 请求最多尝试次数，包含首次请求
+func WithRetries(attempts int) ClientOpt {
+	return func(c *ClientCfg) {
+		c.retryPolicy.MaxAttempts = attempts
+	}
+}
+
+// WithMaxConcurrency 批量请求分组后最多同时发送的分组数
+func WithMaxConcurrency(n int) ClientOpt {
+	return func(c *ClientCfg) {
+		c.maxConcurrency = n
+	}
+}
+
+// WithTracerProvider 指定请求span使用的 TracerProvider，默认使用 otel 全局配置
+func WithTracerProvider(provider trace.TracerProvider) ClientOpt {
+	return func(c *ClientCfg) {
+		c.tracerProvider = provider
+	}
+}
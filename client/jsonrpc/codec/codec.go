@@ -32,3 +32,13 @@ func (e *ErrorObject) Error() string {
 	}
 	return string(data)
 }
+
+// ErrorCode 实现 rpc.Error
+func (e *ErrorObject) ErrorCode() int {
+	return e.Code
+}
+
+// ErrorData 实现 rpc.DataError
+func (e *ErrorObject) ErrorData() interface{} {
+	return e.Data
+}
@@ -0,0 +1,361 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ewmaAlpha 延迟及错误率的平滑系数
+const ewmaAlpha = 0.2
+
+// batchTooLargeMessages 节点拒绝批量请求过大时的错误信息
+var batchTooLargeMessages = []string{
+	"batch too large",
+	"batch size",
+	"batch limit",
+	"maximum batch",
+	"too many requests in batch",
+}
+
+// Endpoint 节点配置，Weight越大被选中的概率越高
+type Endpoint struct {
+	// Name 节点名称，用于日志、监控标签及trace，为空时使用脱敏后的节点地址(scheme://host)
+	Name   string
+	Weight int
+	// Group 节点分组，如 archive、trace，由 WithRoutes 决定哪些请求发往该分组
+	Group string
+	Opts  []PoolCfgOpt
+}
+
+// EndpointStat 节点健康状态
+type EndpointStat struct {
+	Name      string
+	Weight    int
+	Latency   time.Duration
+	ErrorRate float64
+	Head      uint64
+	Healthy   bool
+	// BatchLimit 当前使用的批量请求上限
+	BatchLimit int
+	// Quota 每个方法已消耗的额度
+	Quota map[string]MethodQuota
+	// ChainID 节点返回的链id，未校验时为0
+	ChainID uint64
+}
+
+type endpoint struct {
+	name    string
+	group   string
+	weight  int
+	pool    *Pool
+	limiter *limiter
+
+	mu           sync.RWMutex
+	batchLimit   int
+	latency      time.Duration
+	errorRate    float64
+	head         uint64
+	lagging      bool
+	ejectedUntil time.Time
+	// chainID 节点返回的链id，与 pool.chainID 不一致时节点不会被使用
+	chainID uint64
+	// unsupported 节点返回方法不存在的方法，之后优先发往其他节点
+	unsupported map[string]bool
+}
+
+func newEndpoint(e Endpoint, cfg *ClientCfg) (*endpoint, error) {
+	p, err := NewPool(e.Opts...)
+	if err != nil {
+		return nil, err
+	}
+	name := e.Name
+	if name == "" {
+		name = p.endpoint
+	}
+	weight := e.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	batchLimit := p.batchLimit
+	if batchLimit <= 0 {
+		batchLimit = cfg.groupSize
+	}
+	return &endpoint{name: name, group: e.Group, weight: weight, pool: p, limiter: newLimiter(p.rateLimit), batchLimit: batchLimit}, nil
+}
+
+// call 限流后发送单个请求
+func (e *endpoint) call(ctx context.Context, method string, out interface{}, args ...interface{}) error {
+	if err := e.limiter.wait(ctx, method); err != nil {
+		return err
+	}
+	return e.observeRetryAfter(e.pool.RunContext(ctx, func(client transport.Transport) error {
+		return client.CallContext(ctx, out, method, args...)
+	}))
+}
+
+// batchCall 按节点的批量上限拆分请求，节点拒绝批量过大时缩小上限并记住，然后重新发送
+func (e *endpoint) batchCall(ctx context.Context, batch []rpc.BatchElem) error {
+	for len(batch) > 0 {
+		size := e.getBatchLimit()
+		if size > len(batch) {
+			size = len(batch)
+		}
+		methods := make([]string, size)
+		for idx := range batch[:size] {
+			methods[idx] = batch[idx].Method
+		}
+		if err := e.limiter.wait(ctx, methods...); err != nil {
+			return err
+		}
+		err := e.observeRetryAfter(e.pool.RunContext(ctx, func(client transport.Transport) error {
+			return client.BatchCallContext(ctx, batch[:size])
+		}))
+		if size > 1 && (isBatchTooLarge(err) || (err == nil && allBatchTooLarge(batch[:size]))) {
+			e.shrinkBatchLimit(ctx, size)
+			for idx := range batch[:size] {
+				batch[idx].Error = nil
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		batch = batch[size:]
+	}
+	return nil
+}
+
+// observeRetryAfter 节点限流时按 Retry-After 暂停该节点的请求
+func (e *endpoint) observeRetryAfter(err error) error {
+	var retryAfterErr *transport.RetryAfterError
+	if errors.As(err, &retryAfterErr) {
+		e.limiter.pause(retryAfterErr.RetryAfter)
+	}
+	return err
+}
+
+func (e *endpoint) getBatchLimit() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.batchLimit
+}
+
+// shrinkBatchLimit 批量大小为rejected的请求被拒绝后减半上限
+func (e *endpoint) shrinkBatchLimit(ctx context.Context, rejected int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if limit := rejected / 2; limit < e.batchLimit {
+		e.batchLimit = limit
+		log.Warn(ctx, "endpoint rejected batch, shrink batch limit", "endpoint", e.name, "rejected", rejected, "batch_limit", limit)
+	}
+}
+
+func isBatchTooLarge(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, tooLarge := range batchTooLargeMessages {
+		if strings.Contains(msg, tooLarge) {
+			return true
+		}
+	}
+	return false
+}
+
+// allBatchTooLarge 部分节点拒绝时给每个元素都返回批量过大的错误
+func allBatchTooLarge(batch []rpc.BatchElem) bool {
+	for idx := range batch {
+		if !isBatchTooLarge(batch[idx].Error) {
+			return false
+		}
+	}
+	return true
+}
+
+// observe 记录一次请求的耗时及结果，错误率超过阈值时摘除节点
+func (e *endpoint) observe(cost time.Duration, failed bool, cfg *ClientCfg) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if failed {
+		e.errorRate = e.errorRate*(1-ewmaAlpha) + ewmaAlpha
+	} else {
+		e.errorRate = e.errorRate * (1 - ewmaAlpha)
+		if e.latency == 0 {
+			e.latency = cost
+		} else {
+			e.latency = time.Duration(float64(e.latency)*(1-ewmaAlpha) + float64(cost)*ewmaAlpha)
+		}
+	}
+	if failed && e.errorRate > cfg.maxErrorRate {
+		e.ejectedUntil = time.Now().Add(cfg.ejectDuration)
+		// 恢复后给节点重新证明自己的机会
+		e.errorRate = cfg.maxErrorRate / 2
+	}
+}
+
+// markUnsupported 记录节点不支持的方法
+func (e *endpoint) markUnsupported(ctx context.Context, method string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.unsupported == nil {
+		e.unsupported = make(map[string]bool)
+	}
+	if !e.unsupported[method] {
+		e.unsupported[method] = true
+		log.Warn(ctx, "endpoint does not support method", "endpoint", e.name, "method", method)
+	}
+}
+
+// supports 节点是否支持全部方法，未请求过的方法视为支持
+func (e *endpoint) supports(methods ...string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, method := range methods {
+		if e.unsupported[method] {
+			return false
+		}
+	}
+	return true
+}
+
+// supporting 支持全部方法的节点，都不支持时返回全部节点
+func supporting(endpoints []*endpoint, methods ...string) []*endpoint {
+	result := make([]*endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.supports(methods...) {
+			result = append(result, e)
+		}
+	}
+	if len(result) == 0 {
+		return endpoints
+	}
+	return result
+}
+
+// isMethodNotFound 节点不支持该方法
+func isMethodNotFound(err error) bool {
+	return err != nil && errors.Is(errs.Classify(err), errs.MethodNotFound)
+}
+
+func (e *endpoint) setHead(head uint64) {
+	e.mu.Lock()
+	e.head = head
+	e.mu.Unlock()
+}
+
+func (e *endpoint) setLagging(lagging bool) {
+	e.mu.Lock()
+	e.lagging = lagging
+	e.mu.Unlock()
+}
+
+func (e *endpoint) healthy() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return !e.lagging && time.Now().After(e.ejectedUntil) && e.servesChain()
+}
+
+// servesChain 未要求校验链id，或者节点已确认服务于期望的链
+func (e *endpoint) servesChain() bool {
+	return e.pool.chainID == 0 || e.chainID == e.pool.chainID
+}
+
+// verifyChain 请求节点的链id，不一致时返回 errs.ChainIDMismatch
+func (e *endpoint) verifyChain(ctx context.Context) error {
+	var chainID math.HexOrDecimal64
+	if err := e.call(ctx, "eth_chainId", &chainID); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.chainID = uint64(chainID)
+	e.mu.Unlock()
+	if uint64(chainID) != e.pool.chainID {
+		return errs.New(errs.ChainIDMismatch, fmt.Sprintf("endpoint %s chain id is %d, expect %d", e.name, uint64(chainID), e.pool.chainID))
+	}
+	return nil
+}
+
+// score 节点得分，权重越高、错误率越低、延迟越低得分越高
+func (e *endpoint) score() float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return float64(e.weight) * (1 - e.errorRate) / (1 + float64(e.latency)/float64(100*time.Millisecond))
+}
+
+func (e *endpoint) stat() EndpointStat {
+	healthy := e.healthy()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return EndpointStat{
+		Name:       e.name,
+		Weight:     e.weight,
+		Latency:    e.latency,
+		ErrorRate:  e.errorRate,
+		Head:       e.head,
+		Healthy:    healthy,
+		BatchLimit: e.batchLimit,
+		Quota:      e.limiter.usage(),
+		ChainID:    e.chainID,
+	}
+}
+
+// orderEndpoints 按得分加权随机选出首选节点，其余节点按得分降序作为备选
+// 没有健康节点时退化为使用全部节点，链id不一致或尚未校验的节点始终不使用
+func orderEndpoints(endpoints []*endpoint) []*endpoint {
+	candidates := make([]*endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.healthy() {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, e := range endpoints {
+			e.mu.RLock()
+			serves := e.servesChain()
+			e.mu.RUnlock()
+			if serves {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if len(candidates) <= 1 {
+		return candidates
+	}
+	scores := make(map[*endpoint]float64, len(candidates))
+	var total float64
+	for _, e := range candidates {
+		scores[e] = e.score()
+		total += scores[e]
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i]] > scores[candidates[j]]
+	})
+	if total <= 0 {
+		return candidates
+	}
+	pick := rand.Float64() * total
+	for idx, e := range candidates {
+		if pick -= scores[e]; pick <= 0 {
+			copy(candidates[1:idx+1], candidates[:idx])
+			candidates[0] = e
+			break
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,182 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// hedgeWindow 每个方法保留的最近耗时样本数
+	hedgeWindow = 100
+	// hedgeMinSamples 样本数不足时使用 HedgePolicy.MaxDelay
+	hedgeMinSamples = 20
+)
+
+// HedgePolicy 对冲策略，请求超过延迟仍未返回时发往另一个节点，取先成功的结果并取消另一个请求
+type HedgePolicy struct {
+	// Methods 允许对冲的方法，以*结尾时按前缀匹配，非幂等方法始终不对冲
+	Methods []string
+	// Percentile 按该方法最近成功请求耗时的分位数(0~1)决定对冲延迟
+	Percentile float64
+	// MinDelay 对冲延迟下限
+	MinDelay time.Duration
+	// MaxDelay 对冲延迟上限，样本不足时使用该值
+	MaxDelay time.Duration
+}
+
+// DefaultHedgePolicy 对常用的只读方法按P95耗时对冲
+func DefaultHedgePolicy() HedgePolicy {
+	return HedgePolicy{
+		Methods: []string{
+			"eth_blockNumber",
+			"eth_chainId",
+			"eth_getBalance",
+			"eth_getCode",
+			"eth_call",
+			"eth_getLogs",
+			"eth_getBlockByNumber",
+			"eth_getBlockByHash",
+			"eth_getTransactionByHash",
+			"eth_getTransactionReceipt",
+			"eth_getBlockReceipts",
+		},
+		Percentile: 0.95,
+		MinDelay:   50 * time.Millisecond,
+		MaxDelay:   2 * time.Second,
+	}
+}
+
+// WithHedging 开启请求对冲，只对单个请求生效，批量请求不对冲
+func WithHedging(policy HedgePolicy) ClientOpt {
+	return func(c *ClientCfg) {
+		c.hedgePolicy = &policy
+	}
+}
+
+// hedger 记录各方法的耗时，计算对冲延迟
+type hedger struct {
+	policy HedgePolicy
+
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+func newHedger(policy HedgePolicy) *hedger {
+	return &hedger{policy: policy, samples: make(map[string][]time.Duration), next: make(map[string]int)}
+}
+
+func (h *hedger) allowed(method string) bool {
+	return !nonRetryableMethods[method] && matchMethod(h.policy.Methods, method)
+}
+
+// record 记录一次成功请求的耗时，超过窗口大小时覆盖最旧的样本
+func (h *hedger) record(method string, cost time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if samples := h.samples[method]; len(samples) < hedgeWindow {
+		h.samples[method] = append(samples, cost)
+		return
+	}
+	h.samples[method][h.next[method]] = cost
+	h.next[method] = (h.next[method] + 1) % hedgeWindow
+}
+
+// delay 最近耗时的分位数，限制在 [MinDelay, MaxDelay] 内
+func (h *hedger) delay(method string) time.Duration {
+	h.mu.Lock()
+	samples := append([]time.Duration(nil), h.samples[method]...)
+	h.mu.Unlock()
+	if len(samples) < hedgeMinSamples {
+		return h.policy.MaxDelay
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	idx := int(h.policy.Percentile * float64(len(samples)))
+	if idx >= len(samples) {
+		idx = len(samples) - 1
+	}
+	delay := samples[idx]
+	if delay < h.policy.MinDelay {
+		delay = h.policy.MinDelay
+	}
+	if h.policy.MaxDelay > 0 && delay > h.policy.MaxDelay {
+		delay = h.policy.MaxDelay
+	}
+	return delay
+}
+
+type hedgeResult struct {
+	e    *endpoint
+	raw  json.RawMessage
+	cost time.Duration
+	err  error
+}
+
+// hedge 先请求首选节点，超过对冲延迟未返回时请求下一个节点，节点不可达或不支持该方法时立即切换
+// 每个请求的结果写入各自的 json.RawMessage，成功后再解码到out，避免并发写out
+func (c *Client) hedge(ctx context.Context, method string, endpoints []*endpoint, out interface{}, runnable func(ctx context.Context, e *endpoint, out interface{}) error) (err error) {
+	endpoints = orderEndpoints(endpoints)
+	if len(endpoints) == 0 {
+		return errChainIDMismatch()
+	}
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, len(endpoints))
+	next, inflight := 0, 0
+	launch := func() {
+		e := endpoints[next]
+		next++
+		inflight++
+		go func() {
+			var raw json.RawMessage
+			start := time.Now()
+			err := runnable(hedgeCtx, e, &raw)
+			results <- hedgeResult{e: e, raw: raw, cost: time.Since(start), err: err}
+		}()
+	}
+	launch()
+	timer := time.NewTimer(c.hedger.delay(method))
+	defer timer.Stop()
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			if next < len(endpoints) {
+				hedgesTotal.WithLabelValues(method).Inc()
+				launch()
+			}
+		case r := <-results:
+			inflight--
+			if ctx.Err() != nil {
+				// 调用方放弃的请求不计入节点错误率
+				return r.err
+			}
+			failed := isTransportError(r.err)
+			r.e.observe(r.cost, failed, c.cfg)
+			if !failed && !isMethodNotFound(r.err) {
+				if r.err != nil {
+					return r.err
+				}
+				c.hedger.record(method, r.cost)
+				if out == nil {
+					return nil
+				}
+				// 部分transport结果为null时不写入result
+				if len(r.raw) == 0 {
+					r.raw = json.RawMessage("null")
+				}
+				return json.Unmarshal(r.raw, out)
+			}
+			err = r.err
+			log.Warn(ctx, "endpoint request failed, try next endpoint", "endpoint", r.e.name, "err", err)
+			if next < len(endpoints) {
+				launch()
+			}
+		}
+	}
+	return err
+}
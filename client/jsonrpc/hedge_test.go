@@ -0,0 +1,96 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// delayTransport 延迟delay后返回，ctx取消时立即返回
+type delayTransport struct {
+	stubTransport
+	delay time.Duration
+	calls int64
+	// null 结果为null，不写入result
+	null bool
+}
+
+func (d *delayTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	atomic.AddInt64(&d.calls, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d.delay):
+	}
+	if d.null {
+		return nil
+	}
+	return json.Unmarshal([]byte(`"0x7"`), result)
+}
+
+func TestClient_hedge(t *testing.T) {
+	slow, fast := &delayTransport{delay: time.Second}, &delayTransport{}
+	endpoint := func(name string, weight int, tr *delayTransport) Endpoint {
+		return Endpoint{Name: name, Weight: weight, Opts: []PoolCfgOpt{WithSharedTransport(name, tr), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}}
+	}
+	policy := DefaultHedgePolicy()
+	policy.MaxDelay = 20 * time.Millisecond
+	c, err := NewFailoverClient([]Endpoint{endpoint("slow", 1000000, slow), endpoint("fast", 1, fast)}, WithHedging(policy), WithHealthCheck(0, 0))
+	assert.NoError(t, err)
+	defer c.Release()
+
+	start := time.Now()
+	var head math.HexOrDecimal64
+	assert.NoError(t, c.CallContext(context.Background(), "eth_blockNumber", &head))
+	assert.Equal(t, uint64(7), uint64(head))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&slow.calls))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fast.calls))
+
+	assert.False(t, c.hedger.allowed("eth_sendRawTransaction"))
+	assert.False(t, newHedger(HedgePolicy{Methods: []string{"eth_*"}}).allowed("eth_sendRawTransaction"))
+	assert.True(t, newHedger(HedgePolicy{Methods: []string{"eth_*"}}).allowed("eth_getLogs"))
+}
+
+func TestClient_hedgeNull(t *testing.T) {
+	tr := &delayTransport{null: true}
+	c, err := NewFailoverClient([]Endpoint{
+		{Name: "null", Opts: []PoolCfgOpt{WithSharedTransport("null", tr), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}},
+	}, WithHedging(DefaultHedgePolicy()), WithHealthCheck(0, 0))
+	assert.NoError(t, err)
+	defer c.Release()
+
+	// 交易不存在时节点返回null
+	tx := &struct{ Hash string }{Hash: "0x1"}
+	assert.NoError(t, c.CallContext(context.Background(), "eth_getTransactionByHash", &tx, "0x1"))
+	assert.Nil(t, tx)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&tr.calls))
+}
+
+func Test_hedgerDelay(t *testing.T) {
+	h := newHedger(HedgePolicy{Percentile: 0.9, MinDelay: 5 * time.Millisecond, MaxDelay: time.Second})
+	assert.Equal(t, time.Second, h.delay("eth_call"))
+	for i := 1; i <= 2*hedgeWindow; i++ {
+		h.record("eth_call", time.Duration(i)*time.Millisecond)
+	}
+	// 只保留最近的 hedgeWindow 个样本
+	assert.Equal(t, 191*time.Millisecond, h.delay("eth_call"))
+}
+
+func TestClient_callTimeout(t *testing.T) {
+	tr := &delayTransport{delay: time.Second}
+	c, err := NewFailoverClient([]Endpoint{
+		{Name: "slow", Opts: []PoolCfgOpt{WithSharedTransport("slow", tr), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}},
+	}, WithCallTimeout(20*time.Millisecond), WithHealthCheck(0, 0))
+	assert.NoError(t, err)
+	defer c.Release()
+
+	var head string
+	start := time.Now()
+	assert.ErrorIs(t, c.Call("eth_blockNumber", &head), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
@@ -0,0 +1,77 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/metrics"
+	"strings"
+	"time"
+)
+
+// 请求及连接池指标，通过 metrics.SetBackend 设置的实现记录
+var (
+	requestsTotal = metrics.NewCounterVec("jsonrpc_requests_total",
+		"JSON-RPC requests sent to endpoints, batch elements are counted separately.", "method", "endpoint")
+	requestErrors = metrics.NewCounterVec("jsonrpc_request_errors_total",
+		"JSON-RPC requests failed, by error class.", "method", "endpoint", "class")
+	requestDuration = metrics.NewHistogramVec("jsonrpc_request_duration_seconds",
+		"JSON-RPC request latency, batch segments use method=\"batch\".", nil, "method", "endpoint")
+	batchSize = metrics.NewHistogramVec("jsonrpc_batch_size",
+		"Number of requests in a batch segment.", []float64{1, 5, 10, 20, 50, 100, 200, 500}, "endpoint")
+	retriesTotal = metrics.NewCounterVec("jsonrpc_retries_total",
+		"JSON-RPC requests retried by the retry policy.", "method")
+	hedgesTotal = metrics.NewCounterVec("jsonrpc_hedged_requests_total",
+		"JSON-RPC requests hedged to another endpoint after the hedge delay.", "method")
+
+	poolActive = metrics.NewGaugeVec("jsonrpc_pool_active_connections",
+		"Connections currently taken from the pool.", "endpoint")
+	poolIdle = metrics.NewGaugeVec("jsonrpc_pool_idle_connections",
+		"Idle connections in the pool.", "endpoint")
+	poolWait = metrics.NewHistogramVec("jsonrpc_pool_wait_seconds",
+		"Time spent waiting for a connection from the pool.", nil, "endpoint")
+)
+
+// observeCall 记录单个请求
+func observeCall(e *endpoint, method string, cost time.Duration, err error) {
+	requestsTotal.WithLabelValues(method, e.name).Inc()
+	requestDuration.WithLabelValues(method, e.name).Observe(cost.Seconds())
+	if err != nil {
+		requestErrors.WithLabelValues(method, e.name, errorClass(err)).Inc()
+	}
+}
+
+// observeBatch 记录一个批量分组，整组失败时每个元素都计为失败
+func observeBatch(e *endpoint, batch []rpc.BatchElem, cost time.Duration, err error) {
+	requestDuration.WithLabelValues("batch", e.name).Observe(cost.Seconds())
+	batchSize.WithLabelValues(e.name).Observe(float64(len(batch)))
+	for idx := range batch {
+		requestsTotal.WithLabelValues(batch[idx].Method, e.name).Inc()
+		elemErr := batch[idx].Error
+		if err != nil {
+			elemErr = err
+		}
+		if elemErr != nil {
+			requestErrors.WithLabelValues(batch[idx].Method, e.name, errorClass(elemErr)).Inc()
+		}
+	}
+}
+
+// errorClass 错误分类，节点返回的已知错误按 errs 中的类型区分
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	var rpcErr *errs.RpcError
+	if errors.As(errs.Classify(err), &rpcErr) {
+		return strings.ReplaceAll(rpcErr.Kind.Error(), " ", "_")
+	}
+	if isTransportError(err) {
+		return "transport"
+	}
+	return "rpc"
+}
@@ -1,50 +1,233 @@
 package jsonrpc
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/silenceper/pool"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
+	"sync"
+	"time"
 )
 
+// ErrDialBackoff 建立连接失败后处于退避期，暂不重新建立连接
+var ErrDialBackoff = errors.New("dial backoff")
+
+// headerSetter 支持设置header的transport
+type headerSetter interface {
+	SetHeader(key, value string)
+}
+
+// conn 连接池中的连接，记录开始空闲的时间用于探活
+type conn struct {
+	transport.Transport
+	idleSince time.Time
+}
+
+// dialer 建立连接并设置header，失败后按指数退避，退避期内直接返回 ErrDialBackoff
+type dialer struct {
+	factory    func() (interface{}, error)
+	headers    map[string]string
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	mu       sync.Mutex
+	failures int
+	next     time.Time
+}
+
+func (d *dialer) dial() (interface{}, error) {
+	d.mu.Lock()
+	wait := time.Until(d.next)
+	d.mu.Unlock()
+	if wait > 0 {
+		return nil, fmt.Errorf("%w: retry in %s", ErrDialBackoff, wait.Round(time.Millisecond))
+	}
+	v, err := d.factory()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.failures++
+		d.next = time.Now().Add(d.delay())
+		return nil, err
+	}
+	d.failures = 0
+	client := v.(transport.Transport)
+	// header只在建立连接时设置一次，单次请求的header使用 transport.WithHeaders
+	if err = setHeaders(client, d.headers); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &conn{Transport: client, idleSince: time.Now()}, nil
+}
+
+// setHeaders 共享的transport设置到被共享的transport上，不支持设置header时返回错误
+func setHeaders(client transport.Transport, headers map[string]string) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	if shared, ok := client.(sharedTransport); ok {
+		client = shared.Transport
+	}
+	setter, ok := client.(headerSetter)
+	if !ok {
+		return errs.New(errs.InvalidParams, fmt.Sprintf("transport %T does not support rpc headers", client))
+	}
+	for k, v := range headers {
+		setter.SetHeader(k, v)
+	}
+	return nil
+}
+
+func (d *dialer) delay() time.Duration {
+	if d.backoff <= 0 {
+		return 0
+	}
+	delay := d.backoff
+	for i := 1; i < d.failures && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if d.maxBackoff > 0 && delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
 type Pool struct {
 	pool.Pool
-	headers map[string]string
+	// endpoint 脱敏后的节点地址，用于日志及监控标签
+	endpoint   string
+	batchLimit int
+	rateLimit  RateLimit
+	chainID    uint64
 }
 
 func NewPool(opts ...PoolCfgOpt) (*Pool, error) {
-	poolConfig := &PoolCfg{headers: make(map[string]string)}
+	poolConfig := &PoolCfg{
+		headers:        make(map[string]string),
+		pingTimeout:    DefaultPingTimeout,
+		dialBackoff:    DefaultDialBackoff,
+		maxDialBackoff: DefaultMaxDialBackoff,
+	}
 	for _, opt := range opts {
 		opt(poolConfig)
 	}
+	if poolConfig.Factory != nil {
+		d := &dialer{factory: poolConfig.Factory, headers: poolConfig.headers, backoff: poolConfig.dialBackoff, maxBackoff: poolConfig.maxDialBackoff}
+		poolConfig.Factory = d.dial
+	}
+	if poolConfig.pingIdle > 0 {
+		poolConfig.Ping = func(v interface{}) error {
+			return ping(v.(*conn), poolConfig.pingIdle, poolConfig.pingTimeout)
+		}
+	}
 	channelPool, err := pool.NewChannelPool(&poolConfig.Config)
 	if err != nil {
 		return nil, err
 	}
-	return &Pool{Pool: channelPool, headers: poolConfig.headers}, nil
+	return &Pool{Pool: channelPool, endpoint: transport.Redact(poolConfig.endpoint), batchLimit: poolConfig.batchLimit, rateLimit: poolConfig.rateLimit, chainID: poolConfig.chainID}, nil
 }
 
-func (p *Pool) GetClient() (*rpc.Client, error) {
+// ping 空闲超过idle的连接取出前先探测，节点返回jsonrpc错误说明连接可用
+func ping(c *conn, idle, timeout time.Duration) error {
+	if time.Since(c.idleSince) < idle {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var chainID json.RawMessage
+	if err := c.CallContext(ctx, &chainID, "eth_chainId"); isTransportError(err) {
+		return err
+	}
+	return nil
+}
+
+func (p *Pool) GetClient() (transport.Transport, error) {
+	start := time.Now()
 	c, err := p.Get()
+	poolWait.WithLabelValues(p.endpoint).Observe(time.Since(start).Seconds())
 	if err != nil {
 		return nil, err
 	}
-	client := c.(*rpc.Client)
-	if len(p.headers) > 0 {
-		for k, v := range p.headers {
-			client.SetHeader(k, v)
-		}
+	poolActive.WithLabelValues(p.endpoint).Inc()
+	poolIdle.WithLabelValues(p.endpoint).Set(float64(p.Len()))
+	return c.(*conn), nil
+}
+
+// GetClientContext 获取client，连接池耗尽时等待，ctx取消后立即返回
+func (p *Pool) GetClientContext(ctx context.Context) (transport.Transport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type acquired struct {
+		client transport.Transport
+		err    error
+	}
+	ch := make(chan acquired, 1)
+	go func() {
+		client, err := p.GetClient()
+		ch <- acquired{client: client, err: err}
+	}()
+	select {
+	case r := <-ch:
+		return r.client, r.err
+	case <-ctx.Done():
+		// 调用方已放弃，等拿到连接后归还连接池
+		go func() {
+			if r := <-ch; r.err == nil {
+				p.PutClient(r.client)
+			}
+		}()
+		return nil, ctx.Err()
 	}
-	return client, err
 }
 
-func (p *Pool) PutClient(client *rpc.Client) {
+// PutClient 归还 GetClient 获取的连接
+func (p *Pool) PutClient(client transport.Transport) {
+	if c, ok := client.(*conn); ok {
+		c.idleSince = time.Now()
+	}
 	_ = p.Put(client)
+	poolActive.WithLabelValues(p.endpoint).Dec()
+	poolIdle.WithLabelValues(p.endpoint).Set(float64(p.Len()))
 }
 
-func (p *Pool) Run(runnable func(client *rpc.Client) error) error {
-	client, err := p.GetClient()
+// DiscardClient 关闭已损坏的连接，不再归还连接池，之后按需重新建立连接
+func (p *Pool) DiscardClient(client transport.Transport) {
+	_ = p.Close(client)
+	poolActive.WithLabelValues(p.endpoint).Dec()
+	poolIdle.WithLabelValues(p.endpoint).Set(float64(p.Len()))
+}
+
+func (p *Pool) Run(runnable func(client transport.Transport) error) error {
+	return p.RunContext(context.Background(), runnable)
+}
+
+// RunContext 获取client并执行runnable，执行完成后归还，连接损坏时关闭
+func (p *Pool) RunContext(ctx context.Context, runnable func(client transport.Transport) error) error {
+	client, err := p.GetClientContext(ctx)
 	if err != nil {
 		return err
 	}
-	defer p.PutClient(client)
-	return runnable(client)
+	err = runnable(client)
+	if ctx.Err() == nil && isBrokenConn(err) {
+		log.Warn(ctx, "discard broken connection", "endpoint", p.endpoint, "err", err)
+		p.DiscardClient(client)
+		return err
+	}
+	p.PutClient(client)
+	return err
+}
+
+// isBrokenConn 连接层面的错误，节点返回的jsonrpc错误、http状态码及限流不影响连接复用
+func isBrokenConn(err error) bool {
+	if !isTransportError(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	var retryAfterErr *transport.RetryAfterError
+	return !errors.As(err, &httpErr) && !errors.As(err, &retryAfterErr)
 }
@@ -1,8 +1,22 @@
 package jsonrpc
 
-import "github.com/silenceper/pool"
+import (
+	"github.com/silenceper/pool"
+	"time"
+)
 
 type PoolCfg struct {
 	pool.Config
-	headers map[string]string
+	headers    map[string]string
+	endpoint   string
+	batchLimit int
+	rateLimit  RateLimit
+	// chainID 节点应当返回的链id，0表示不校验
+	chainID uint64
+	// pingIdle 空闲超过该时长的连接取出前先探活，<=0 时不探活
+	pingIdle    time.Duration
+	pingTimeout time.Duration
+	// dialBackoff 建立连接失败后的退避时长，连续失败时翻倍直到maxDialBackoff
+	dialBackoff    time.Duration
+	maxDialBackoff time.Duration
 }
@@ -1,15 +1,30 @@
 package jsonrpc
 
 import (
-	"github.com/ethereum/go-ethereum/rpc"
+	"context"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
 	"time"
 )
 
+const (
+	DefaultInitCap     = 5
+	DefaultMaxIdle     = 20
+	DefaultMaxCap      = 100
+	DefaultIdleTimeout = 5 * time.Second
+
+	DefaultPingTimeout    = 3 * time.Second
+	DefaultDialBackoff    = 100 * time.Millisecond
+	DefaultMaxDialBackoff = 10 * time.Second
+)
+
+// InitCap MaxIdle MaxCap IdleTimeout GetDefaultOpts 使用的连接池参数
+//
+// Deprecated: 使用 GetEthCfgOpts 或 WithInitCap 等选项
 var (
-	InitCap     = 5
-	MaxIdle     = 20
-	MaxCap      = 100
-	IdleTimeout = 5 * time.Second
+	InitCap     = DefaultInitCap
+	MaxIdle     = DefaultMaxIdle
+	MaxCap      = DefaultMaxCap
+	IdleTimeout = DefaultIdleTimeout
 )
 
 type PoolCfgOpt func(c *PoolCfg)
@@ -36,32 +51,74 @@ func GetEthCfgOpts(endpoint string, initCap, maxCap, maxIdleCap int, maxIdle tim
 	}
 }
 
-// WithRpcHeaders headers
+// WithRpcHeaders 建立连接时设置的header，单次请求的header使用 transport.WithHeaders
+// transport需要实现 SetHeader(key, value string)，否则建立连接时返回错误，如 transport.Ws
 func WithRpcHeaders(headers map[string]string) PoolCfgOpt {
 	return func(c *PoolCfg) {
 		c.headers = headers
 	}
 }
 
-// WithRpcFactory factory
+// WithRpcFactory factory，使用 go-ethereum rpc.Client 作为传输层
 func WithRpcFactory(endpoint string) PoolCfgOpt {
+	return WithTransportFactory(endpoint, func() (transport.Transport, error) {
+		return transport.DialGeth(endpoint)
+	})
+}
+
+// WithIPCTransport 通过ipc文件连接本地节点
+func WithIPCTransport(path string) PoolCfgOpt {
+	return WithTransportFactory(path, func() (transport.Transport, error) {
+		return transport.DialIPC(context.Background(), path)
+	})
+}
+
+// WithTransportFactory 自定义传输层，每个连接调用一次factory
+func WithTransportFactory(endpoint string, factory func() (transport.Transport, error)) PoolCfgOpt {
 	return func(c *PoolCfg) {
+		c.endpoint = endpoint
 		c.Factory = func() (interface{}, error) {
-			return rpc.Dial(endpoint)
+			return factory()
 		}
 	}
 }
 
+// WithHttpTransport 使用fasthttp作为传输层，连接池中的连接共享同一个 transport.Http
+func WithHttpTransport(h *transport.Http) PoolCfgOpt {
+	return WithSharedTransport(h.Addr(), h)
+}
+
+// WithWsTransport 使用websocket长连接作为传输层，连接池中的连接共享同一个 transport.Ws
+func WithWsTransport(addr string, ws *transport.Ws) PoolCfgOpt {
+	return WithSharedTransport(addr, ws)
+}
+
+// WithSharedTransport 连接池中的连接共享同一个transport，连接池不会关闭它，由调用方负责关闭
+func WithSharedTransport(endpoint string, t transport.Transport) PoolCfgOpt {
+	shared := sharedTransport{Transport: t}
+	return WithTransportFactory(endpoint, func() (transport.Transport, error) {
+		return shared, nil
+	})
+}
+
 // WithRpcClose rpc close时
 func WithRpcClose() PoolCfgOpt {
 	return func(c *PoolCfg) {
 		c.Close = func(v interface{}) error {
-			v.(*rpc.Client).Close()
-			return nil
+			return v.(transport.Transport).Close()
 		}
 	}
 }
 
+// sharedTransport 共享的transport，连接池回收连接时不关闭
+type sharedTransport struct {
+	transport.Transport
+}
+
+func (s sharedTransport) Close() error {
+	return nil
+}
+
 func WithInitCap(cap int) PoolCfgOpt {
 	return func(c *PoolCfg) {
 		c.InitialCap = cap
@@ -85,3 +142,39 @@ func WithIdleTimeout(t time.Duration) PoolCfgOpt {
 		c.IdleTimeout = t
 	}
 }
+
+// WithBatchLimit 节点已知的单次批量请求上限，不设置时使用client的分组大小
+func WithBatchLimit(limit int) PoolCfgOpt {
+	return func(c *PoolCfg) {
+		c.batchLimit = limit
+	}
+}
+
+// WithRateLimit 节点限流及每个方法消耗的额度
+func WithRateLimit(limit RateLimit) PoolCfgOpt {
+	return func(c *PoolCfg) {
+		c.rateLimit = limit
+	}
+}
+
+// WithChainID 节点应当返回的链id，创建client时及探活时校验，不一致的节点不会被使用
+func WithChainID(id uint64) PoolCfgOpt {
+	return func(c *PoolCfg) {
+		c.chainID = id
+	}
+}
+
+// WithPing 空闲超过idle的连接取出前先请求 eth_chainId 探活，失败的连接被关闭
+func WithPing(idle time.Duration) PoolCfgOpt {
+	return func(c *PoolCfg) {
+		c.pingIdle = idle
+	}
+}
+
+// WithDialBackoff 建立连接失败后的退避时长，连续失败时翻倍，backoff<=0 时不退避
+func WithDialBackoff(backoff, maxBackoff time.Duration) PoolCfgOpt {
+	return func(c *PoolCfg) {
+		c.dialBackoff = backoff
+		c.maxDialBackoff = maxBackoff
+	}
+}
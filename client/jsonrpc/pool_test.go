@@ -0,0 +1,179 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testEthService struct {
+	head uint64
+}
+
+func (s *testEthService) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(s.head)
+}
+
+func newTestServer(t *testing.T, head uint64) *rpc.Server {
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", &testEthService{head: head}))
+	return server
+}
+
+// withInProc 连接到进程内的rpc server
+func withInProc(server *rpc.Server) PoolCfgOpt {
+	return WithTransportFactory("inproc", func() (transport.Transport, error) {
+		return transport.NewGeth(rpc.DialInProc(server)), nil
+	})
+}
+
+func newInProcPool(t *testing.T, maxCap int) *Pool {
+	p, err := NewPool(withInProc(newTestServer(t, 1)), WithRpcClose(), WithInitCap(0), WithMaxIdle(maxCap), WithMaxCap(maxCap))
+	assert.NoError(t, err)
+	return p
+}
+
+func TestPool_GetClientContext(t *testing.T) {
+	p := newInProcPool(t, 1)
+	defer p.Release()
+	client, err := p.GetClientContext(context.Background())
+	assert.NoError(t, err)
+
+	// 连接池耗尽，ctx超时后应当立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = p.GetClientContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	p.PutClient(client)
+	client, err = p.GetClientContext(context.Background())
+	assert.NoError(t, err)
+	p.PutClient(client)
+}
+
+// brokenTransport 前failures次请求返回连接错误
+type brokenTransport struct {
+	stubTransport
+	failures *int32
+	closed   bool
+}
+
+func (b *brokenTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if atomic.AddInt32(b.failures, -1) >= 0 {
+		return errors.New("connection reset by peer")
+	}
+	return b.stubTransport.CallContext(ctx, result, method, args...)
+}
+
+func (b *brokenTransport) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestPool_discardBroken(t *testing.T) {
+	failures := int32(1)
+	var dialed []*brokenTransport
+	p, err := NewPool(WithTransportFactory("broken", func() (transport.Transport, error) {
+		b := &brokenTransport{stubTransport: stubTransport{head: 1}, failures: &failures}
+		dialed = append(dialed, b)
+		return b, nil
+	}), WithRpcClose(), WithInitCap(0), WithMaxIdle(1), WithMaxCap(1))
+	assert.NoError(t, err)
+	defer p.Release()
+
+	var head math.HexOrDecimal64
+	call := func(client transport.Transport) error {
+		return client.CallContext(context.Background(), &head, "eth_blockNumber")
+	}
+	assert.Error(t, p.RunContext(context.Background(), call))
+	assert.NoError(t, p.RunContext(context.Background(), call))
+	assert.NoError(t, p.RunContext(context.Background(), call))
+	// 损坏的连接被关闭，之后重新建立的连接可以复用
+	assert.Len(t, dialed, 2)
+	assert.True(t, dialed[0].closed)
+	assert.False(t, dialed[1].closed)
+}
+
+func TestPool_ping(t *testing.T) {
+	failures := int32(0)
+	var dialed int
+	p, err := NewPool(WithTransportFactory("ping", func() (transport.Transport, error) {
+		dialed++
+		return &brokenTransport{stubTransport: stubTransport{head: 1}, failures: &failures}, nil
+	}), WithRpcClose(), WithInitCap(1), WithMaxIdle(1), WithMaxCap(1), WithPing(time.Millisecond))
+	assert.NoError(t, err)
+	defer p.Release()
+
+	// 空闲的连接探活失败，取出时重新建立连接
+	time.Sleep(5 * time.Millisecond)
+	atomic.StoreInt32(&failures, 1)
+	client, err := p.GetClient()
+	assert.NoError(t, err)
+	p.PutClient(client)
+	assert.Equal(t, 2, dialed)
+}
+
+func TestPool_dialBackoff(t *testing.T) {
+	dialErr := errors.New("connection refused")
+	var dialed int
+	p, err := NewPool(WithTransportFactory("down", func() (transport.Transport, error) {
+		dialed++
+		return nil, dialErr
+	}), WithRpcClose(), WithInitCap(0), WithMaxIdle(1), WithMaxCap(1), WithDialBackoff(50*time.Millisecond, time.Second))
+	assert.NoError(t, err)
+	defer p.Release()
+
+	_, err = p.GetClient()
+	assert.ErrorIs(t, err, dialErr)
+	// 退避期内不重新建立连接
+	_, err = p.GetClient()
+	assert.ErrorIs(t, err, ErrDialBackoff)
+	assert.Equal(t, 1, dialed)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = p.GetClient()
+	assert.ErrorIs(t, err, dialErr)
+	assert.Equal(t, 2, dialed)
+}
+
+func TestPool_rpcHeaders(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- r.Header.Get("X-Api-Key"):
+		default:
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x7"}`))
+	}))
+	defer srv.Close()
+
+	// 共享的transport同样设置header
+	p, err := NewPool(WithHttpTransport(transport.NewHttp(srv.URL)), WithRpcHeaders(map[string]string{"X-Api-Key": "secret"}), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1))
+	assert.NoError(t, err)
+	defer p.Release()
+	var head math.HexOrDecimal64
+	assert.NoError(t, p.RunContext(context.Background(), func(client transport.Transport) error {
+		return client.CallContext(context.Background(), &head, "eth_blockNumber")
+	}))
+	assert.Equal(t, "secret", <-received)
+
+	// 不支持header的transport建立连接时报错
+	p, err = NewPool(WithSharedTransport("stub", &stubTransport{head: 1}), WithRpcHeaders(map[string]string{"X-Api-Key": "secret"}), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1))
+	if err == nil {
+		defer p.Release()
+		err = p.RunContext(context.Background(), func(client transport.Transport) error {
+			return client.CallContext(context.Background(), &head, "eth_blockNumber")
+		})
+	}
+	assert.ErrorIs(t, err, errs.InvalidParams)
+}
@@ -0,0 +1,153 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMaxPause 节点给出 Retry-After 时暂停发送请求的上限
+const DefaultMaxPause = 30 * time.Second
+
+// RateLimit 节点限流配置，<=0 表示不限制
+type RateLimit struct {
+	// RequestsPerSecond 每秒请求数，批量请求中的每个元素各算一次
+	RequestsPerSecond float64
+	// UnitsPerSecond 每秒可消耗的额度(compute units)
+	UnitsPerSecond float64
+	// Costs 每个方法消耗的额度，未配置的方法消耗1
+	Costs map[string]float64
+	// MaxPause 按 Retry-After 暂停节点的上限，<=0 时使用 DefaultMaxPause
+	MaxPause time.Duration
+}
+
+func (r RateLimit) maxPause() time.Duration {
+	if r.MaxPause <= 0 {
+		return DefaultMaxPause
+	}
+	return r.MaxPause
+}
+
+func (r RateLimit) cost(method string) float64 {
+	if cost, ok := r.Costs[method]; ok {
+		return cost
+	}
+	return 1
+}
+
+// MethodQuota 单个方法已消耗的额度
+type MethodQuota struct {
+	Requests uint64
+	Units    float64
+}
+
+// bucket 令牌桶，允许令牌为负数，由后续请求等待补齐
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// reserve 取走n个令牌，返回需要等待的时间
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		// 最多允许1秒的突发
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limiter 节点级别的限流及额度统计
+type limiter struct {
+	limit RateLimit
+
+	mu          sync.Mutex
+	requests    *bucket
+	units       *bucket
+	pausedUntil time.Time
+	quota       map[string]*MethodQuota
+}
+
+func newLimiter(limit RateLimit) *limiter {
+	return &limiter{
+		limit:    limit,
+		requests: newBucket(limit.RequestsPerSecond),
+		units:    newBucket(limit.UnitsPerSecond),
+		quota:    make(map[string]*MethodQuota),
+	}
+}
+
+// wait 记录额度并等待到允许发送请求，ctx取消时返回ctx的错误
+func (l *limiter) wait(ctx context.Context, methods ...string) error {
+	l.mu.Lock()
+	now := time.Now()
+	var units float64
+	for _, method := range methods {
+		cost := l.limit.cost(method)
+		units += cost
+		q, ok := l.quota[method]
+		if !ok {
+			q = new(MethodQuota)
+			l.quota[method] = q
+		}
+		q.Requests++
+		q.Units += cost
+	}
+	delay := l.pausedUntil.Sub(now)
+	if d := l.requests.reserve(float64(len(methods)), now); d > delay {
+		delay = d
+	}
+	if d := l.units.reserve(units, now); d > delay {
+		delay = d
+	}
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// pause 节点要求 Retry-After 期间暂停发送请求，最多暂停 RateLimit.MaxPause
+func (l *limiter) pause(d time.Duration) {
+	if maxPause := l.limit.maxPause(); d > maxPause {
+		d = maxPause
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *limiter) usage() map[string]MethodQuota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	usage := make(map[string]MethodQuota, len(l.quota))
+	for method, q := range l.quota {
+		usage[method] = *q
+	}
+	return usage
+}
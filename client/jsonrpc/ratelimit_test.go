@@ -0,0 +1,40 @@
+package jsonrpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBucket_reserve(t *testing.T) {
+	now := time.Now()
+	b := &bucket{rate: 10, tokens: 10, last: now}
+	assert.Equal(t, time.Duration(0), b.reserve(10, now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(5, now))
+	// 1秒后补齐10个令牌
+	assert.Equal(t, time.Duration(0), b.reserve(5, now.Add(time.Second)))
+}
+
+func TestLimiter_wait(t *testing.T) {
+	l := newLimiter(RateLimit{UnitsPerSecond: 100, Costs: map[string]float64{"eth_getLogs": 75}})
+	assert.NoError(t, l.wait(context.Background(), "eth_getLogs", "eth_blockNumber"))
+
+	// 额度耗尽，ctx超时前无法获得令牌
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.wait(ctx, "eth_getLogs"), context.DeadlineExceeded)
+
+	usage := l.usage()
+	assert.Equal(t, MethodQuota{Requests: 2, Units: 150}, usage["eth_getLogs"])
+	assert.Equal(t, MethodQuota{Requests: 1, Units: 1}, usage["eth_blockNumber"])
+}
+
+func TestLimiter_pause(t *testing.T) {
+	l := newLimiter(RateLimit{MaxPause: 20 * time.Millisecond})
+	l.pause(24 * time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, l.wait(ctx, "eth_blockNumber"), "Retry-After is capped by MaxPause")
+	assert.Equal(t, DefaultMaxPause, RateLimit{}.maxPause())
+}
@@ -0,0 +1,188 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// nonRetryableMethods 非幂等方法，失败后不重试
+var nonRetryableMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+// retryableMessages 节点返回的可重试错误信息
+var retryableMessages = []string{
+	"timeout",
+	"timed out",
+	"connection reset",
+	"connection refused",
+	"connection closed",
+	"broken pipe",
+	"eof",
+}
+
+// RetryPolicy 重试策略，重试间隔按指数退避并加入随机抖动
+type RetryPolicy struct {
+	// MaxAttempts 最多请求次数，包含首次请求
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay 单次等待的上限，同样限制节点给出的 Retry-After，<=0 时不限制
+	MaxDelay   time.Duration
+	Multiplier float64
+	// Jitter 抖动比例(0~1)，实际间隔在 delay*(1±Jitter) 之间
+	Jitter float64
+	// Retryable 判断错误是否可以重试，为空时使用 IsRetryable
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 请求次数兼容已废弃的 ReTries
+func DefaultRetryPolicy() RetryPolicy {
+	attempts := ReTries
+	if attempts <= 0 {
+		attempts = DefaultRetries
+	}
+	return RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Multiplier:  2,
+		Jitter:      0.2,
+		Retryable:   IsRetryable,
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return IsRetryable(err)
+	}
+	return p.Retryable(err)
+}
+
+// backoff 第attempt次请求失败后的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// wait 等待重试，节点给出 Retry-After 时至少等待该时长，但不超过 MaxDelay，ctx取消时返回ctx的错误
+func (p RetryPolicy) wait(ctx context.Context, attempt int, cause error) error {
+	timer := time.NewTimer(p.delay(attempt, cause))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (p RetryPolicy) delay(attempt int, cause error) time.Duration {
+	delay := p.backoff(attempt)
+	var retryAfterErr *transport.RetryAfterError
+	if errors.As(cause, &retryAfterErr) && retryAfterErr.RetryAfter > delay {
+		delay = retryAfterErr.RetryAfter
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// IsRetryable 只有已知的暂时性错误可以重试：超时、429、5xx、连接断开、节点暂时找不到区块等
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, errs.ChainIDMismatch) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var retryAfterErr *transport.RetryAfterError
+	if errors.As(err, &retryAfterErr) {
+		return true
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	// 节点限流或者暂时找不到区块(负载均衡后的节点还未同步到)
+	if classified := errs.Classify(err); errors.Is(classified, errs.RateLimited) || errors.Is(classified, errs.BlockNotFound) {
+		return true
+	}
+	// 连接断开、被拒绝等网络错误
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, ErrDialBackoff) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, retryable := range retryableMessages {
+		if strings.Contains(msg, retryable) {
+			return true
+		}
+	}
+	// 其余错误(节点返回的jsonrpc错误、响应解析失败等)重试也无法成功
+	return false
+}
+
+// BatchError 批量请求重试后仍失败的元素及原因
+type BatchError struct {
+	Attempts int
+	// Causes key为元素在批量请求中的下标
+	Causes map[int]error
+}
+
+func (e *BatchError) Error() string {
+	idx := e.indexes()
+	if len(idx) == 0 {
+		return fmt.Sprintf("%v: no elems failed after %d attempts", errs.MaxRetryPollingBatchCall, e.Attempts)
+	}
+	return fmt.Sprintf("%v: %d elems failed after %d attempts, first failed elem %d: %v",
+		errs.MaxRetryPollingBatchCall, len(idx), e.Attempts, idx[0], e.Causes[idx[0]])
+}
+
+// Is 兼容 errs.MaxRetryPollingBatchCall
+func (e *BatchError) Is(target error) bool {
+	return target == errs.MaxRetryPollingBatchCall
+}
+
+// Unwrap 返回下标最小的失败原因
+func (e *BatchError) Unwrap() error {
+	idx := e.indexes()
+	if len(idx) == 0 {
+		return nil
+	}
+	return e.Causes[idx[0]]
+}
+
+func (e *BatchError) indexes() []int {
+	idx := make([]int, 0, len(e.Causes))
+	for i := range e.Causes {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	return idx
+}
@@ -0,0 +1,139 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"github.com/taorzhang/toolkit/errs"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyTransport 第一个参数为元素编号，前failures[id]次请求返回错误
+type flakyTransport struct {
+	mu       sync.Mutex
+	failures map[int]int
+	err      error
+	calls    map[int]int
+}
+
+func (f *flakyTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := args[0].(int)
+	f.calls[id]++
+	if f.calls[id] <= f.failures[id] {
+		return f.err
+	}
+	*result.(*int) = id
+	return nil
+}
+
+func (f *flakyTransport) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for idx := range b {
+		b[idx].Error = f.CallContext(ctx, b[idx].Result, b[idx].Method, b[idx].Args...)
+	}
+	return nil
+}
+
+func (f *flakyTransport) Close() error {
+	return nil
+}
+
+func newFlakyClient(t *testing.T, f *flakyTransport) *Client {
+	c, err := NewFailoverClient([]Endpoint{
+		{Opts: []PoolCfgOpt{WithSharedTransport("flaky", f), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}},
+	}, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Multiplier: 2, Jitter: 0.5}))
+	assert.NoError(t, err)
+	return c
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 400*time.Millisecond, policy.backoff(3))
+	assert.Equal(t, time.Second, policy.backoff(10))
+}
+
+func TestRetryPolicy_delay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	assert.Equal(t, 500*time.Millisecond, policy.delay(1, &transport.RetryAfterError{StatusCode: 429, RetryAfter: 500 * time.Millisecond}))
+	// Retry-After 同样不超过 MaxDelay
+	assert.Equal(t, time.Second, policy.delay(1, &transport.RetryAfterError{StatusCode: 429, RetryAfter: 24 * time.Hour}))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&codec.ErrorObject{Code: -32000, Message: "header not found"}))
+	assert.True(t, IsRetryable(rpc.HTTPError{StatusCode: 429}))
+	assert.True(t, IsRetryable(rpc.HTTPError{StatusCode: 502}))
+	assert.False(t, IsRetryable(rpc.HTTPError{StatusCode: 401}))
+	assert.False(t, IsRetryable(&codec.ErrorObject{Code: -32000, Message: "execution reverted"}))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.True(t, IsRetryable(fmt.Errorf("client do:%w", io.EOF)))
+	assert.True(t, IsRetryable(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}))
+	assert.False(t, IsRetryable(errors.New("json unmarshal response.body:invalid character")))
+	assert.False(t, IsRetryable(errors.New("unknown error")))
+}
+
+func TestBatchError_empty(t *testing.T) {
+	err := &BatchError{Attempts: 3}
+	assert.NotPanics(t, func() {
+		assert.Contains(t, err.Error(), "no elems failed")
+		assert.Nil(t, err.Unwrap())
+	})
+	assert.ErrorIs(t, err, errs.MaxRetryPollingBatchCall)
+}
+
+func TestClient_BatchCallContext_partialRetry(t *testing.T) {
+	f := &flakyTransport{
+		failures: map[int]int{1: 1, 2: 2},
+		err:      &codec.ErrorObject{Code: -32000, Message: "header not found"},
+		calls:    make(map[int]int),
+	}
+	c := newFlakyClient(t, f)
+	defer c.Release()
+
+	results := make([]int, 4)
+	batch := make([]rpc.BatchElem, len(results))
+	for idx := range results {
+		batch[idx] = rpc.BatchElem{Method: "test_echo", Args: []interface{}{idx}, Result: &results[idx]}
+	}
+	assert.NoError(t, c.BatchCallContext(context.Background(), batch, true))
+	assert.Equal(t, []int{0, 1, 2, 3}, results)
+	// 只有失败的元素被重新发送
+	assert.Equal(t, map[int]int{0: 1, 1: 2, 2: 3, 3: 1}, f.calls)
+}
+
+func TestClient_BatchCallContext_causes(t *testing.T) {
+	f := &flakyTransport{
+		failures: map[int]int{1: 10},
+		err:      &codec.ErrorObject{Code: -32000, Message: "header not found"},
+		calls:    make(map[int]int),
+	}
+	c := newFlakyClient(t, f)
+	defer c.Release()
+
+	results := make([]int, 3)
+	batch := make([]rpc.BatchElem, len(results))
+	for idx := range results {
+		batch[idx] = rpc.BatchElem{Method: "test_echo", Args: []interface{}{idx}, Result: &results[idx]}
+	}
+	err := c.BatchCallContext(context.Background(), batch, true)
+	assert.ErrorIs(t, err, errs.MaxRetryPollingBatchCall)
+	var batchErr *BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 3, batchErr.Attempts)
+	assert.Len(t, batchErr.Causes, 1)
+	assert.ErrorIs(t, batchErr.Causes[1], errs.BlockNotFound)
+	var errObj *codec.ErrorObject
+	assert.True(t, errors.As(batchErr.Causes[1], &errObj))
+	assert.Equal(t, f.err, errObj)
+}
@@ -0,0 +1,186 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/errs"
+	"strings"
+)
+
+// Route 路由规则，方法或区块范围匹配时请求发往Group分组的节点
+type Route struct {
+	// Group 节点分组，对应 Endpoint.Group
+	Group string
+	// Methods 方法名，以*结尾时按前缀匹配，如 trace_*，为空时匹配全部方法
+	Methods []string
+	// OlderThan 请求的区块落后最新高度超过该值时匹配，0表示不按区块判断
+	// 只对 blockParams 中的方法生效，最新高度来自探活
+	OlderThan uint64
+}
+
+// blockParams 区块参数在参数列表中的位置
+var blockParams = map[string]int{
+	"eth_getBalance":                       1,
+	"eth_getCode":                          1,
+	"eth_getTransactionCount":              1,
+	"eth_getStorageAt":                     2,
+	"eth_call":                             1,
+	"eth_getProof":                         2,
+	"eth_getBlockByNumber":                 0,
+	"eth_getBlockReceipts":                 0,
+	"trace_block":                          0,
+	"debug_traceBlockByNumber":             0,
+	"eth_getUncleCountByBlockNumber":       0,
+	"eth_getBlockTransactionCountByNumber": 0,
+}
+
+// TraceRoute trace及debug方法发往group
+func TraceRoute(group string) Route {
+	return Route{Group: group, Methods: []string{"trace_*", "debug_*"}}
+}
+
+// ArchiveRoute 查询落后最新高度超过olderThan的历史状态时发往group
+func ArchiveRoute(group string, olderThan uint64) Route {
+	return Route{Group: group, Methods: []string{"eth_getBalance", "eth_getCode", "eth_getTransactionCount", "eth_getStorageAt", "eth_call", "eth_getProof"}, OlderThan: olderThan}
+}
+
+// WithRoutes 按顺序匹配的路由规则，都不匹配时使用未分组的节点
+func WithRoutes(routes ...Route) ClientOpt {
+	return func(c *ClientCfg) {
+		c.routes = append(c.routes, routes...)
+	}
+}
+
+func (r *Route) matchMethod(method string) bool {
+	return len(r.Methods) == 0 || matchMethod(r.Methods, method)
+}
+
+// matchMethod 方法名是否在列表中，以*结尾的按前缀匹配
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.HasSuffix(m, "*") && strings.HasPrefix(method, strings.TrimSuffix(m, "*")) {
+			return true
+		}
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// match head为0时最新高度未知，不按区块范围匹配
+func (r *Route) match(method string, args []interface{}, head uint64) bool {
+	if !r.matchMethod(method) {
+		return false
+	}
+	if r.OlderThan == 0 {
+		return true
+	}
+	idx, ok := blockParams[method]
+	if !ok || idx >= len(args) || head == 0 {
+		return false
+	}
+	number, ok := blockNumberArg(args[idx])
+	return ok && number+r.OlderThan < head
+}
+
+// blockNumberArg 解析区块参数，latest、pending等标签返回false，earliest视为0
+func blockNumberArg(arg interface{}) (uint64, bool) {
+	raw, err := json.Marshal(arg)
+	if err != nil {
+		return 0, false
+	}
+	var v interface{}
+	if err = json.Unmarshal(raw, &v); err != nil {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case float64:
+		return uint64(v), v >= 0
+	case string:
+		if v == "earliest" {
+			return 0, true
+		}
+		number, err := hexutil.DecodeUint64(v)
+		return number, err == nil
+	case map[string]interface{}:
+		// EIP-1898 {"blockNumber": "0x..."}
+		if number, ok := v["blockNumber"]; ok {
+			return blockNumberArg(number)
+		}
+	}
+	return 0, false
+}
+
+// router 路由表及分组后的节点
+type router struct {
+	routes   []Route
+	groups   map[string][]*endpoint
+	fallback []*endpoint
+}
+
+func newRouter(routes []Route, endpoints []*endpoint) (*router, error) {
+	r := &router{routes: routes, groups: make(map[string][]*endpoint)}
+	for _, e := range endpoints {
+		if e.group == "" {
+			r.fallback = append(r.fallback, e)
+		} else {
+			r.groups[e.group] = append(r.groups[e.group], e)
+		}
+	}
+	if len(r.fallback) == 0 {
+		// 所有节点都有分组时，不匹配路由的请求可以发往任意节点
+		r.fallback = endpoints
+	}
+	for _, route := range routes {
+		if len(r.groups[route.Group]) == 0 {
+			return nil, errs.New(errs.InvalidParams, fmt.Sprintf("route group %q has no endpoint", route.Group))
+		}
+	}
+	return r, nil
+}
+
+// route 请求使用的节点分组，不匹配任何路由时为空
+func (r *router) route(method string, args []interface{}, head uint64) string {
+	for idx := range r.routes {
+		if r.routes[idx].match(method, args, head) {
+			return r.routes[idx].Group
+		}
+	}
+	return ""
+}
+
+// endpoints 分组内的节点
+func (r *router) endpoints(group string) []*endpoint {
+	if group == "" {
+		return r.fallback
+	}
+	return r.groups[group]
+}
+
+// routedBatch 路由到同一组节点的批量请求，idx为元素在原批量请求中的位置
+type routedBatch struct {
+	endpoints []*endpoint
+	batch     []rpc.BatchElem
+	idx       []int
+}
+
+// split 按路由拆分批量请求，保持元素的相对顺序
+func (r *router) split(elems []rpc.BatchElem, head uint64) []*routedBatch {
+	batches := make([]*routedBatch, 0)
+	byGroup := make(map[string]*routedBatch)
+	for idx := range elems {
+		group := r.route(elems[idx].Method, elems[idx].Args, head)
+		b, ok := byGroup[group]
+		if !ok {
+			b = &routedBatch{endpoints: r.endpoints(group)}
+			byGroup[group] = b
+			batches = append(batches, b)
+		}
+		b.batch = append(b.batch, elems[idx])
+		b.idx = append(b.idx, idx)
+	}
+	return batches
+}
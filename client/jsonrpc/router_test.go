@@ -0,0 +1,91 @@
+package jsonrpc
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/errs"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// routedTransport 记录收到的请求方法
+type routedTransport struct {
+	stubTransport
+	mu      sync.Mutex
+	methods []string
+}
+
+func (r *routedTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	r.mu.Lock()
+	r.methods = append(r.methods, method)
+	r.mu.Unlock()
+	return r.stubTransport.CallContext(ctx, result, method, args...)
+}
+
+func (r *routedTransport) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for idx := range b {
+		b[idx].Error = r.CallContext(ctx, b[idx].Result, b[idx].Method, b[idx].Args...)
+	}
+	return nil
+}
+
+func (r *routedTransport) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	methods := append([]string(nil), r.methods...)
+	sort.Strings(methods)
+	r.methods = nil
+	return methods
+}
+
+func TestClient_routes(t *testing.T) {
+	full, archive, trace := &routedTransport{}, &routedTransport{}, &routedTransport{}
+	endpoint := func(name, group string, tr *routedTransport) Endpoint {
+		return Endpoint{Name: name, Group: group, Opts: []PoolCfgOpt{WithSharedTransport(name, tr), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}}
+	}
+	_, err := NewFailoverClient([]Endpoint{endpoint("full", "", full)}, WithRoutes(TraceRoute("trace")))
+	assert.ErrorIs(t, err, errs.InvalidParams)
+
+	c, err := NewFailoverClient([]Endpoint{endpoint("full", "", full), endpoint("archive", "archive", archive), endpoint("trace", "trace", trace)},
+		WithRoutes(TraceRoute("trace"), ArchiveRoute("archive", 128)), WithHealthCheck(0, 0))
+	assert.NoError(t, err)
+	defer c.Release()
+	for _, e := range c.endpoints {
+		e.setHead(1000)
+	}
+
+	ctx := context.Background()
+	var out math.HexOrDecimal64
+	assert.NoError(t, c.CallContext(ctx, "eth_getBalance", &out, "0x00000000000000000000000000000000000000aa", "0x10"))
+	assert.NoError(t, c.CallContext(ctx, "eth_getBalance", &out, "0x00000000000000000000000000000000000000aa", "latest"))
+	assert.NoError(t, c.CallContext(ctx, "trace_transaction", &out, "0x01"))
+	assert.Equal(t, []string{"eth_getBalance"}, archive.received())
+	assert.Equal(t, []string{"eth_getBalance"}, full.received())
+	assert.Equal(t, []string{"trace_transaction"}, trace.received())
+
+	// 混合的批量请求按路由拆分，结果写回原位置
+	results := make([]math.HexOrDecimal64, 4)
+	batch := []rpc.BatchElem{
+		{Method: "eth_blockNumber", Result: &results[0]},
+		{Method: "debug_traceTransaction", Args: []interface{}{"0x01"}, Result: &results[1]},
+		{Method: "eth_call", Args: []interface{}{map[string]interface{}{}, map[string]interface{}{"blockNumber": "0x1"}}, Result: &results[2]},
+		{Method: "eth_call", Args: []interface{}{map[string]interface{}{}, "0x3e0"}, Result: &results[3]},
+	}
+	assert.NoError(t, c.BatchCallContext(ctx, batch, true))
+	assert.Equal(t, []string{"eth_blockNumber", "eth_call"}, full.received())
+	assert.Equal(t, []string{"debug_traceTransaction"}, trace.received())
+	assert.Equal(t, []string{"eth_call"}, archive.received())
+}
+
+func Test_blockNumberArg(t *testing.T) {
+	for arg, expect := range map[interface{}]uint64{"0x10": 16, "earliest": 0, rpc.BlockNumber(5): 5, math.HexOrDecimal64(7): 7} {
+		number, ok := blockNumberArg(arg)
+		assert.True(t, ok, "%v", arg)
+		assert.Equal(t, expect, number)
+	}
+	_, ok := blockNumberArg("latest")
+	assert.False(t, ok)
+}
@@ -0,0 +1,93 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/taorzhang/toolkit/client/jsonrpc"
+
+// span 属性
+const (
+	attrSystem    = attribute.Key("rpc.system")
+	attrMethod    = attribute.Key("rpc.method")
+	attrMethods   = attribute.Key("rpc.jsonrpc.methods")
+	attrBatchSize = attribute.Key("rpc.jsonrpc.batch_size")
+	attrFailed    = attribute.Key("rpc.jsonrpc.failed")
+	attrEndpoint  = attribute.Key("rpc.endpoint")
+	attrAttempt   = attribute.Key("rpc.attempt")
+)
+
+func (c *Client) tracer() trace.Tracer {
+	provider := c.cfg.tracerProvider
+	if provider == nil {
+		// 每次获取，client创建之后才初始化的全局配置同样生效
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startCallSpan 单个请求发往某个节点的span
+func (c *Client) startCallSpan(ctx context.Context, e *endpoint, method string, attempt int) (context.Context, trace.Span) {
+	return c.tracer().Start(ctx, "jsonrpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrSystem.String("jsonrpc"),
+			attrMethod.String(method),
+			attrEndpoint.String(e.name),
+			attrAttempt.Int(attempt),
+		))
+}
+
+// startBatchSpan 批量请求的一个分组发往某个节点的span
+func (c *Client) startBatchSpan(ctx context.Context, e *endpoint, batch []rpc.BatchElem, attempt int) (context.Context, trace.Span) {
+	return c.tracer().Start(ctx, "jsonrpc batch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrSystem.String("jsonrpc"),
+			attrMethods.StringSlice(batchMethods(batch)),
+			attrBatchSize.Int(len(batch)),
+			attrEndpoint.String(e.name),
+			attrAttempt.Int(attempt),
+		))
+}
+
+// endSpan 记录请求结果，批量请求中部分元素失败时记录失败数量
+func endSpan(span trace.Span, err error, batch []rpc.BatchElem) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	var failed int
+	for idx := range batch {
+		if batch[idx].Error != nil {
+			failed++
+		}
+	}
+	if batch != nil {
+		span.SetAttributes(attrFailed.Int(failed))
+	}
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d requests failed", failed, len(batch)))
+	}
+}
+
+// batchMethods 批量请求中去重后的方法名，保持出现顺序
+func batchMethods(batch []rpc.BatchElem) []string {
+	seen := make(map[string]bool)
+	methods := make([]string, 0)
+	for idx := range batch {
+		if !seen[batch[idx].Method] {
+			seen[batch[idx].Method] = true
+			methods = append(methods, batch[idx].Method)
+		}
+	}
+	return methods
+}
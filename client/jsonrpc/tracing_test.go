@@ -0,0 +1,81 @@
+package jsonrpc
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdk_trace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func spanAttrs(span sdk_trace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestClient_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdk_trace.NewTracerProvider(sdk_trace.WithSpanProcessor(recorder))
+	c, err := NewFailoverClient([]Endpoint{
+		{Name: "stub", Opts: []PoolCfgOpt{WithSharedTransport("stub", &limitedTransport{stubTransport: stubTransport{head: 7}, limit: 10}), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}},
+	}, WithTracerProvider(provider), WithGroupSize(2), WithMaxConcurrency(1))
+	assert.NoError(t, err)
+	defer c.Release()
+
+	var head math.HexOrDecimal64
+	assert.NoError(t, c.CallContext(context.Background(), "eth_blockNumber", &head))
+	heads := make([]math.HexOrDecimal64, 5)
+	batch := make([]rpc.BatchElem, len(heads))
+	for idx := range heads {
+		batch[idx] = rpc.BatchElem{Method: "eth_blockNumber", Result: &heads[idx]}
+	}
+	assert.NoError(t, c.BatchCallContext(context.Background(), batch, true))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 4)
+	attrs := spanAttrs(spans[0])
+	assert.Equal(t, "jsonrpc eth_blockNumber", spans[0].Name())
+	assert.Equal(t, "stub", attrs[attrEndpoint].AsString())
+	assert.Equal(t, int64(1), attrs[attrAttempt].AsInt64())
+	var sizes []int64
+	for _, span := range spans[1:] {
+		attrs = spanAttrs(span)
+		assert.Equal(t, "jsonrpc batch", span.Name())
+		assert.Equal(t, []string{"eth_blockNumber"}, attrs[attrMethods].AsStringSlice())
+		assert.Equal(t, int64(0), attrs[attrFailed].AsInt64())
+		sizes = append(sizes, attrs[attrBatchSize].AsInt64())
+	}
+	assert.Equal(t, []int64{2, 2, 1}, sizes)
+}
+
+// rejectTransport 所有请求都返回jsonrpc错误
+type rejectTransport struct {
+	stubTransport
+}
+
+func (r *rejectTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return &codec.ErrorObject{Code: -32601, Message: "method not found"}
+}
+
+func TestClient_tracingError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdk_trace.NewTracerProvider(sdk_trace.WithSpanProcessor(recorder))
+	c, err := NewFailoverClient([]Endpoint{
+		{Opts: []PoolCfgOpt{WithSharedTransport("reject", new(rejectTransport)), WithRpcClose(), WithMaxIdle(1), WithMaxCap(1)}},
+	}, WithTracerProvider(provider))
+	assert.NoError(t, err)
+	defer c.Release()
+
+	assert.Error(t, c.CallContext(context.Background(), "eth_foo", nil))
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryAfterError 节点限流(429)并通过 Retry-After 给出了可重试的时间
+type RetryAfterError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+// HTTPStatusCode 供 errs.Classify 识别限流
+func (e *RetryAfterError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%d %s, retry after %s", e.StatusCode, http.StatusText(e.StatusCode), e.RetryAfter)
+}
+
+// parseRetryAfter Retry-After 可以是秒数或者http时间
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Geth go-ethereum rpc.Client，根据地址协议自动选择http、websocket或ipc
+type Geth struct {
+	*rpc.Client
+}
+
+func NewGeth(client *rpc.Client) *Geth {
+	return &Geth{Client: client}
+}
+
+// DialGeth 连接节点，endpoint 可以是 http(s)://、ws(s):// 或 ipc 文件路径
+func DialGeth(endpoint string) (*Geth, error) {
+	var client *rpc.Client
+	var err error
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		client, err = rpc.DialHTTPWithClient(endpoint, &http.Client{Transport: &roundTripper{base: http.DefaultTransport}})
+	} else {
+		client, err = rpc.Dial(endpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewGeth(client), nil
+}
+
+// DialIPC 通过ipc文件连接本地节点
+func DialIPC(ctx context.Context, path string) (*Geth, error) {
+	client, err := rpc.DialIPC(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGeth(client), nil
+}
+
+// Close 关闭连接
+func (g *Geth) Close() error {
+	g.Client.Close()
+	return nil
+}
+
+// roundTripper 附加 WithHeaders 设置的header，并将带 Retry-After 的429响应转换为 RetryAfterError
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if headers := HeadersFromContext(req.Context()); len(headers) > 0 {
+		// RoundTripper 不能修改传入的请求
+		req = req.Clone(req.Context())
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := r.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if !ok {
+		return resp, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return nil, &RetryAfterError{StatusCode: resp.StatusCode, RetryAfter: retryAfter}
+}
@@ -0,0 +1,24 @@
+package transport
+
+import "context"
+
+type headersKey struct{}
+
+// WithHeaders 单次请求附加的header，覆盖连接上的同名header，只对http及geth http连接生效
+// 多次调用时合并，不会修改上层ctx中的header
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range HeadersFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// HeadersFromContext 取出 WithHeaders 设置的header，返回值不能修改
+func HeadersFromContext(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
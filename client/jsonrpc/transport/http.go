@@ -1,57 +1,230 @@
 package transport
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	errMissingResponse = errors.New("missing response in batch")
+)
+
+// DefaultHttpTimeout 未设置超时且ctx没有deadline时单次请求的超时
+const DefaultHttpTimeout = time.Minute
+
 type Http struct {
 	addr    string
+	mu      sync.RWMutex
 	headers map[string]string
 	client  *fasthttp.Client
+	timeout time.Duration
+	gzip    bool
+	id      uint64
 }
 
 func NewHttp(addr string) *Http {
 	return &Http{addr: addr, client: &fasthttp.Client{}, headers: make(map[string]string)}
 }
 
+// Addr 节点地址
+func (h *Http) Addr() string {
+	return h.addr
+}
+
 // SetHeaders 设置header头
 func (h *Http) SetHeaders(headers map[string]string) {
 	if len(headers) > 0 {
+		h.mu.Lock()
 		h.headers = headers
+		h.mu.Unlock()
 	}
 }
 
+// SetHeader 设置单个header，连接池通过它设置 WithRpcHeaders 的header
+func (h *Http) SetHeader(key, value string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	headers := make(map[string]string, len(h.headers)+1)
+	for k, v := range h.headers {
+		headers[k] = v
+	}
+	headers[key] = value
+	h.headers = headers
+}
+
 // SetMaxConnPerHost 设置最大连接
 func (h *Http) SetMaxConnPerHost(count int) {
 	h.client.MaxConnsPerHost = count
 }
 
+// SetTimeout 单次请求超时时间，ctx的deadline更早时以ctx为准，<=0 时只使用ctx的deadline，ctx也没有deadline时为 DefaultHttpTimeout
+func (h *Http) SetTimeout(timeout time.Duration) {
+	h.timeout = timeout
+}
+
+// SetGzip 是否接受gzip压缩的响应
+func (h *Http) SetGzip(enable bool) {
+	h.gzip = enable
+}
+
 // Close 关闭连接
 func (h *Http) Close() error {
+	h.client.CloseIdleConnections()
 	return nil
 }
 
 // Call standard eth method call
 func (h *Http) Call(method string, out interface{}, params ...interface{}) error {
-	request := codec.Request{
-		ID:      1,
+	return h.CallContext(context.Background(), out, method, params...)
+}
+
+// CallContext 单独一个call，参数顺序与 rpc.Client 保持一致
+func (h *Http) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	request, err := h.newRequest(method, args...)
+	if err != nil {
+		return err
+	}
+	body, err := h.do(ctx, request)
+	if err != nil {
+		return err
+	}
+	var response codec.Response
+	if err = json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("json unmarshal response.body:%v", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("json unmarshal response.result:%v", err)
+	}
+	return nil
+}
+
+// BatchCallContext 批量call，按请求id将响应对应到每个BatchElem
+// 单个请求的错误写入 BatchElem.Error，只有整个批量请求失败时才返回error
+func (h *Http) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if len(b) == 0 {
+		return nil
+	}
+	requests := make([]*codec.Request, len(b))
+	byID := make(map[uint64]int, len(b))
+	for idx := range b {
+		request, err := h.newRequest(b[idx].Method, b[idx].Args...)
+		if err != nil {
+			return err
+		}
+		requests[idx] = request
+		byID[request.ID] = idx
+	}
+	body, err := h.do(ctx, requests)
+	if err != nil {
+		return err
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		// 节点拒绝整个批量请求时返回单个错误对象
+		var response codec.Response
+		if err = json.Unmarshal(body, &response); err != nil {
+			return fmt.Errorf("json unmarshal response.body:%v", err)
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+		return fmt.Errorf("unexpected non-batch response: %s", body)
+	}
+	var responses []codec.Response
+	if err = json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("json unmarshal response.body:%v", err)
+	}
+	answered := make([]bool, len(b))
+	for _, response := range responses {
+		idx, ok := byID[response.ID]
+		if !ok || answered[idx] {
+			continue
+		}
+		answered[idx] = true
+		elem := &b[idx]
+		switch {
+		case response.Error != nil:
+			elem.Error = response.Error
+		case elem.Result == nil || len(response.Result) == 0:
+			elem.Error = nil
+		default:
+			elem.Error = json.Unmarshal(response.Result, elem.Result)
+		}
+	}
+	for idx := range answered {
+		if !answered[idx] {
+			b[idx].Error = errMissingResponse
+		}
+	}
+	return nil
+}
+
+func (h *Http) newRequest(method string, params ...interface{}) (*codec.Request, error) {
+	request := &codec.Request{
+		ID:      atomic.AddUint64(&h.id, 1),
 		JsonRPC: "2.0",
 		Method:  method,
 	}
 	if len(params) > 0 {
 		data, err := json.Marshal(params)
 		if err != nil {
-			return fmt.Errorf("marshal request params:%v", err)
+			return nil, fmt.Errorf("marshal request params:%v", err)
 		}
 		request.Params = data
 	}
-	raw, err := json.Marshal(request)
+	return request, nil
+}
+
+// do 发送请求并返回响应body，http状态码非2xx时返回 rpc.HTTPError
+// fasthttp 不支持ctx，请求在单独的goroutine中执行，ctx取消时立即返回，请求最迟在deadline时结束
+func (h *Http) do(ctx context.Context, msg interface{}) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(msg)
 	if err != nil {
-		return fmt.Errorf("marshal request:%v", err)
+		return nil, fmt.Errorf("marshal request:%v", err)
+	}
+	type result struct {
+		body []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		body, err := h.roundTrip(ctx, raw)
+		done <- result{body: body, err: err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+		}
+		return r.body, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
+
+// roundTrip 发送一次http请求，返回拷贝后的响应body
+func (h *Http) roundTrip(ctx context.Context, raw []byte) ([]byte, error) {
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseRequest(req)
@@ -59,33 +232,79 @@ func (h *Http) Call(method string, out interface{}, params ...interface{}) error
 	req.SetRequestURI(h.addr)
 	req.Header.SetMethod("POST")
 	req.Header.SetContentType("application/json")
-	for k, v := range h.headers {
-		req.Header.Add(k, v)
+	if h.gzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	h.mu.RLock()
+	headers := h.headers
+	h.mu.RUnlock()
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
+	for k, v := range HeadersFromContext(ctx) {
+		req.Header.Set(k, v)
+	}
+	// 通过header传递trace上下文，未初始化tracing时不写入
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{header: &req.Header})
 	req.SetBody(raw)
-	if err = h.client.Do(req, resp); err != nil {
-		return fmt.Errorf("clinet do:%v", err)
+	if err := h.client.DoDeadline(req, resp, h.deadline(ctx)); err != nil {
+		return nil, fmt.Errorf("client do:%w", err)
 	}
-	var response codec.Response
-	if err = json.Unmarshal(resp.Body(), &response); err != nil {
-		return fmt.Errorf("json unmarshal response.body:%v", err)
+	body := resp.Body()
+	var err error
+	if bytes.EqualFold(resp.Header.Peek("Content-Encoding"), []byte("gzip")) {
+		if body, err = resp.BodyGunzip(); err != nil {
+			return nil, fmt.Errorf("gunzip response.body:%v", err)
+		}
 	}
-	if response.Error != nil {
-		return fmt.Errorf("response error:%v", response.Error)
+	code := resp.StatusCode()
+	if code == fasthttp.StatusTooManyRequests {
+		if retryAfter, ok := parseRetryAfter(string(resp.Header.Peek("Retry-After"))); ok {
+			return nil, &RetryAfterError{StatusCode: code, RetryAfter: retryAfter}
+		}
+	}
+	if code < 200 || code >= 300 {
+		return nil, rpc.HTTPError{
+			StatusCode: code,
+			Status:     fmt.Sprintf("%d %s", code, fasthttp.StatusMessage(code)),
+			Body:       append([]byte(nil), body...),
+		}
 	}
+	// resp释放后body不可用，需要拷贝
+	return append([]byte(nil), body...), nil
+}
 
-	if err = json.Unmarshal(response.Result, out); err != nil {
-		return fmt.Errorf("json unmarshal response.result:%v", err)
+// deadline 取ctx deadline与超时时间中较早的一个，都没有设置时使用 DefaultHttpTimeout
+func (h *Http) deadline(ctx context.Context) time.Time {
+	deadline, ok := ctx.Deadline()
+	if h.timeout > 0 {
+		if timeout := time.Now().Add(h.timeout); !ok || timeout.Before(deadline) {
+			return timeout
+		}
 	}
-	return nil
+	if !ok {
+		return time.Now().Add(DefaultHttpTimeout)
+	}
+	return deadline
 }
 
-// EthCall 单独一个eth call
-func (h *Http) EthCall() error {
-	return nil
+// headerCarrier 将 fasthttp 请求头适配为 propagation.TextMapCarrier
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
 }
 
-// BatchEthCall 批量执行 eth call
-func (h *Http) BatchEthCall() error {
-	return nil
+func (c headerCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c.header.Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0)
+	c.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
 }
@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdk_trace "go.opentelemetry.io/otel/sdk/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testEthService struct{}
+
+func (s *testEthService) BlockNumber() hexutil.Uint64 {
+	return 100
+}
+
+func (s *testEthService) ChainId() hexutil.Uint64 {
+	return 1
+}
+
+func newTestHttp(t *testing.T) (*Http, func()) {
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", new(testEthService)))
+	httpServer := httptest.NewServer(server)
+	h := NewHttp(httpServer.URL)
+	h.SetTimeout(time.Second)
+	return h, func() {
+		httpServer.Close()
+		server.Stop()
+	}
+}
+
+func TestHttp_CallContext(t *testing.T) {
+	h, stop := newTestHttp(t)
+	defer stop()
+
+	var number hexutil.Uint64
+	assert.NoError(t, h.CallContext(context.Background(), &number, "eth_blockNumber"))
+	assert.Equal(t, hexutil.Uint64(100), number)
+
+	err := h.CallContext(context.Background(), &number, "eth_notExist")
+	var errObj *codec.ErrorObject
+	assert.True(t, errors.As(err, &errObj))
+	assert.Equal(t, -32601, errObj.ErrorCode())
+}
+
+func TestHttp_BatchCallContext(t *testing.T) {
+	h, stop := newTestHttp(t)
+	defer stop()
+
+	var number, chainID, missing hexutil.Uint64
+	batch := []rpc.BatchElem{
+		{Method: "eth_blockNumber", Result: &number},
+		{Method: "eth_notExist", Result: &missing},
+		{Method: "eth_chainId", Result: &chainID},
+	}
+	assert.NoError(t, h.BatchCallContext(context.Background(), batch))
+	assert.NoError(t, batch[0].Error)
+	assert.Equal(t, hexutil.Uint64(100), number)
+	var errObj *codec.ErrorObject
+	assert.True(t, errors.As(batch[1].Error, &errObj))
+	assert.NoError(t, batch[2].Error)
+	assert.Equal(t, hexutil.Uint64(1), chainID)
+}
+
+func TestHttp_propagation(t *testing.T) {
+	headers := make(chan string, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer httpServer.Close()
+
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagator)
+
+	ctx, span := sdk_trace.NewTracerProvider().Tracer("test").Start(context.Background(), "call")
+	defer span.End()
+	var number hexutil.Uint64
+	assert.NoError(t, NewHttp(httpServer.URL).CallContext(ctx, &number, "eth_blockNumber"))
+	assert.Contains(t, <-headers, span.SpanContext().TraceID().String())
+}
+
+func TestHttp_headers(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer httpServer.Close()
+
+	h := NewHttp(httpServer.URL)
+	h.SetHeaders(map[string]string{"X-Api-Key": "key", "X-Tenant": "default"})
+	ctx := WithHeaders(context.Background(), map[string]string{"X-Tenant": "alice"})
+	var number hexutil.Uint64
+	assert.NoError(t, h.CallContext(ctx, &number, "eth_blockNumber"))
+	header := <-headers
+	assert.Equal(t, "key", header.Get("X-Api-Key"))
+	assert.Equal(t, "alice", header.Get("X-Tenant"))
+
+	// 单次请求的header不影响其他请求
+	assert.NoError(t, h.CallContext(context.Background(), &number, "eth_blockNumber"))
+	assert.Equal(t, "default", (<-headers).Get("X-Tenant"))
+}
+
+func TestHttp_cancel(t *testing.T) {
+	release := make(chan struct{})
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer httpServer.Close()
+	defer close(release)
+	h := NewHttp(httpServer.URL)
+
+	// 没有deadline的ctx取消后立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	var number hexutil.Uint64
+	err := h.CallContext(ctx, &number, "eth_blockNumber")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = h.BatchCallContext(ctx, []rpc.BatchElem{{Method: "eth_blockNumber", Result: &number}})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,276 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
+	"os"
+	"sync"
+)
+
+// ErrNoFixture 回放时找不到匹配的请求
+var ErrNoFixture = errors.New("no matching fixture")
+
+// Interaction 一次jsonrpc请求及其响应，批量请求中的每个元素各记录一条
+type Interaction struct {
+	Method string             `json:"method"`
+	Params json.RawMessage    `json:"params"`
+	Result json.RawMessage    `json:"result,omitempty"`
+	Error  *codec.ErrorObject `json:"error,omitempty"`
+}
+
+// match 请求方法及参数是否一致
+func (i *Interaction) match(method string, params json.RawMessage) bool {
+	return i.Method == method && bytes.Equal(i.Params, params)
+}
+
+// LoadFixture 读取录制的fixture文件
+func LoadFixture(path string) ([]*Interaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []*Interaction
+	if err = json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+	for _, interaction := range interactions {
+		// 文件中的参数可能经过格式化或手工编辑，统一规范化后再比较
+		if interaction.Params, err = canonical(interaction.Params); err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", path, err)
+		}
+	}
+	return interactions, nil
+}
+
+// SaveFixture 写入fixture文件
+func SaveFixture(path string, interactions []*Interaction) error {
+	data, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder 记录经过的请求及响应，用于生成回放测试的fixture
+type Recorder struct {
+	Transport
+	mu           sync.Mutex
+	interactions []*Interaction
+}
+
+func NewRecorder(t Transport) *Recorder {
+	return &Recorder{Transport: t}
+}
+
+func (r *Recorder) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	var raw json.RawMessage
+	err := r.Transport.CallContext(ctx, &raw, method, args...)
+	r.record(ctx, method, args, raw, err)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
+
+func (r *Recorder) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	raws := make([]json.RawMessage, len(b))
+	batch := make([]rpc.BatchElem, len(b))
+	for idx := range b {
+		batch[idx] = rpc.BatchElem{Method: b[idx].Method, Args: b[idx].Args, Result: &raws[idx]}
+	}
+	// 整个批量请求失败时不记录，回放时同样无法得到响应
+	if err := r.Transport.BatchCallContext(ctx, batch); err != nil {
+		return err
+	}
+	for idx := range b {
+		r.record(ctx, b[idx].Method, b[idx].Args, raws[idx], batch[idx].Error)
+		b[idx].Error = batch[idx].Error
+		if b[idx].Error == nil && b[idx].Result != nil && len(raws[idx]) > 0 {
+			b[idx].Error = json.Unmarshal(raws[idx], b[idx].Result)
+		}
+	}
+	return nil
+}
+
+// record 只记录节点的响应及jsonrpc错误，网络错误不记录
+func (r *Recorder) record(ctx context.Context, method string, args []interface{}, raw json.RawMessage, err error) {
+	interaction := &Interaction{Method: method, Result: raw}
+	if err != nil {
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) {
+			return
+		}
+		interaction.Result = nil
+		var errObj *codec.ErrorObject
+		if errors.As(err, &errObj) {
+			interaction.Error = &codec.ErrorObject{Code: errObj.Code, Message: errObj.Message, Data: errObj.Data}
+		} else {
+			interaction.Error = &codec.ErrorObject{Code: rpcErr.ErrorCode(), Message: rpcErr.Error()}
+			var dataErr rpc.DataError
+			if errors.As(err, &dataErr) {
+				interaction.Error.Data = dataErr.ErrorData()
+			}
+		}
+	}
+	params, err := marshalParams(args)
+	if err != nil {
+		log.Warn(ctx, "record request failed", "method", method, "err", err)
+		return
+	}
+	interaction.Params = params
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+}
+
+// Interactions 已经记录的请求
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Interaction(nil), r.interactions...)
+}
+
+// Save 将记录的请求写入fixture文件
+func (r *Recorder) Save(path string) error {
+	return SaveFixture(path, r.Interactions())
+}
+
+// MatchMode 回放时请求的匹配方式
+type MatchMode int
+
+const (
+	// MatchStrict 按方法及参数匹配尚未使用的记录，每条记录只能使用一次，相同的请求按录制的顺序返回
+	// 不要求请求的顺序，并发发送的批量分组可以乱序到达
+	MatchStrict MatchMode = iota
+	// MatchLenient 忽略顺序，只按方法及参数匹配，记录可以重复使用
+	MatchLenient
+)
+
+// Replay 使用录制的fixture响应请求，不访问网络
+type Replay struct {
+	mode         MatchMode
+	mu           sync.Mutex
+	interactions []*Interaction
+	// used 严格模式下已经使用过的记录
+	used      []bool
+	remaining int
+}
+
+func NewReplay(interactions []*Interaction, mode MatchMode) *Replay {
+	return &Replay{interactions: interactions, mode: mode, used: make([]bool, len(interactions)), remaining: len(interactions)}
+}
+
+// LoadReplay 从fixture文件创建回放
+func LoadReplay(path string, mode MatchMode) (*Replay, error) {
+	interactions, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplay(interactions, mode), nil
+}
+
+func (r *Replay) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	interaction, err := r.find(method, args)
+	if err != nil {
+		return err
+	}
+	return interaction.decode(result)
+}
+
+func (r *Replay) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for idx := range b {
+		interaction, err := r.find(b[idx].Method, b[idx].Args)
+		if err != nil {
+			return err
+		}
+		b[idx].Error = interaction.decode(b[idx].Result)
+	}
+	return nil
+}
+
+func (r *Replay) Close() error {
+	return nil
+}
+
+// Remaining 严格模式下尚未被使用的记录数
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining
+}
+
+func (r *Replay) find(method string, args []interface{}) (*Interaction, error) {
+	params, err := marshalParams(args)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for idx, interaction := range r.interactions {
+		if r.mode == MatchStrict && r.used[idx] {
+			continue
+		}
+		if interaction.match(method, params) {
+			if r.mode == MatchStrict {
+				r.used[idx] = true
+				r.remaining--
+			}
+			return interaction, nil
+		}
+	}
+	if r.mode == MatchStrict {
+		return nil, fmt.Errorf("%w: unexpected %s %s, no unused fixture matches", ErrNoFixture, method, params)
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoFixture, method, params)
+}
+
+func (i *Interaction) decode(result interface{}) error {
+	if i.Error != nil {
+		errObj := *i.Error
+		return &errObj
+	}
+	if result == nil || len(i.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(i.Result, result)
+}
+
+// marshalParams 参数序列化为规范化的json数组，作为匹配的依据
+func marshalParams(args []interface{}) (json.RawMessage, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	return canonical(raw)
+}
+
+// canonical 去掉空白并按key排序对象字段，数字保持原样
+func canonical(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("[]"), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	h, stop := newTestHttp(t)
+	defer stop()
+	ctx := context.Background()
+
+	recorder := NewRecorder(h)
+	var number, chainID hexutil.Uint64
+	assert.NoError(t, recorder.CallContext(ctx, &number, "eth_blockNumber"))
+	batch := []rpc.BatchElem{
+		{Method: "eth_chainId", Result: &chainID},
+		{Method: "eth_notExist", Args: []interface{}{"0x1", true}, Result: new(hexutil.Uint64)},
+	}
+	assert.NoError(t, recorder.BatchCallContext(ctx, batch))
+	assert.Equal(t, hexutil.Uint64(1), chainID)
+	assert.Error(t, batch[1].Error)
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	assert.NoError(t, recorder.Save(path))
+
+	replay, err := LoadReplay(path, MatchStrict)
+	assert.NoError(t, err)
+	// 严格模式不要求顺序，但每条记录只能使用一次
+	chainID = 0
+	assert.NoError(t, replay.CallContext(ctx, &chainID, "eth_chainId"))
+	assert.Equal(t, hexutil.Uint64(1), chainID)
+	err = replay.CallContext(ctx, new(hexutil.Uint64), "eth_chainId")
+	assert.True(t, errors.Is(err, ErrNoFixture))
+	number = 0
+	assert.NoError(t, replay.CallContext(ctx, &number, "eth_blockNumber"))
+	assert.Equal(t, hexutil.Uint64(100), number)
+	err = replay.CallContext(ctx, new(hexutil.Uint64), "eth_notExist", "0x2", true)
+	assert.True(t, errors.Is(err, ErrNoFixture))
+	assert.Equal(t, 1, replay.Remaining())
+
+	replay, err = LoadReplay(path, MatchLenient)
+	assert.NoError(t, err)
+	err = replay.CallContext(ctx, new(hexutil.Uint64), "eth_notExist", "0x1", true)
+	var errObj *codec.ErrorObject
+	assert.True(t, errors.As(err, &errObj))
+	assert.Equal(t, -32601, errObj.ErrorCode())
+	for i := 0; i < 2; i++ {
+		chainID = 0
+		assert.NoError(t, replay.CallContext(ctx, &chainID, "eth_chainId"))
+		assert.Equal(t, hexutil.Uint64(1), chainID)
+	}
+	err = replay.CallContext(ctx, new(hexutil.Uint64), "eth_notExist", "0x2", true)
+	assert.True(t, errors.Is(err, ErrNoFixture))
+}
+
+func TestReplay_concurrent(t *testing.T) {
+	// 并发的批量分组乱序到达时严格模式同样可以匹配
+	interactions := make([]*Interaction, 0, 20)
+	for i := 0; i < 20; i++ {
+		params, err := marshalParams([]interface{}{hexutil.Uint64(i), false})
+		assert.NoError(t, err)
+		interactions = append(interactions, &Interaction{Method: "eth_getBlockByNumber", Params: params, Result: []byte(`{}`)})
+	}
+	replay := NewReplay(interactions, MatchStrict)
+	var wg sync.WaitGroup
+	for i := 19; i >= 0; i -= 5 {
+		batch := make([]rpc.BatchElem, 0, 5)
+		for j := i; j > i-5; j-- {
+			batch = append(batch, rpc.BatchElem{Method: "eth_getBlockByNumber", Args: []interface{}{hexutil.Uint64(j), false}, Result: new(map[string]interface{})})
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, replay.BatchCallContext(context.Background(), batch))
+			for idx := range batch {
+				assert.NoError(t, batch[idx].Error)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, replay.Remaining())
+}
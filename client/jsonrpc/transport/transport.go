@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/rpc"
+	"net/url"
+	"strings"
+)
+
+// Transport jsonrpc传输层，geth rpc、fasthttp、websocket、ipc及测试替身均实现该接口
+type Transport interface {
+	// CallContext 单独一个call，节点返回的jsonrpc错误应实现 rpc.Error
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	// BatchCallContext 批量call，单个请求的错误写入 BatchElem.Error
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+	// Close 关闭连接
+	Close() error
+}
+
+var (
+	_ Transport = new(Geth)
+	_ Transport = new(Http)
+	_ Transport = new(Ws)
+	_ Transport = new(Recorder)
+	_ Transport = new(Replay)
+)
+
+// Redact 去掉节点地址中的用户信息、路径及参数，只保留 scheme://host，用于日志、监控标签等
+// 节点地址的路径、参数中通常包含 api key
+func Redact(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		// 无法解析的地址只保留第一个 / ? # 之前的部分
+		if i := strings.IndexAny(addr, "/?#@"); i >= 0 {
+			return addr[:i]
+		}
+		return addr
+	}
+	return u.Scheme + "://" + u.Host
+}
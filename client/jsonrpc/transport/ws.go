@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/logs"
+	"time"
+)
+
+const (
+	minResubscribeInterval = time.Second
+	maxResubscribeInterval = 30 * time.Second
+)
+
+var (
+	log = logs.NewLogger("module", "transport")
+)
+
+// Ws websocket长连接，连接断开后下一次请求时自动重连
+type Ws struct {
+	addr   string
+	client *rpc.Client
+}
+
+func NewWs(ctx context.Context, addr string) (*Ws, error) {
+	client, err := rpc.DialWebsocket(ctx, addr, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Ws{addr: addr, client: client}, nil
+}
+
+// Close 关闭连接，所有订阅随之结束
+func (w *Ws) Close() error {
+	w.client.Close()
+	return nil
+}
+
+// CallContext 单独一个call
+func (w *Ws) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return w.client.CallContext(ctx, result, method, args...)
+}
+
+// BatchCallContext 批量call
+func (w *Ws) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	return w.client.BatchCallContext(ctx, b)
+}
+
+// Subscribe eth_subscribe订阅，连接断开后自动重连并重新订阅
+// ctx取消后取消订阅并关闭返回的channel
+func (w *Ws) Subscribe(ctx context.Context, args ...interface{}) (<-chan json.RawMessage, error) {
+	notifications := make(chan json.RawMessage)
+	sub, err := w.client.EthSubscribe(ctx, notifications, args...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan json.RawMessage)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Unsubscribe()
+				return
+			case msg := <-notifications:
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					sub.Unsubscribe()
+					return
+				}
+			case err := <-sub.Err():
+				log.Warn(ctx, "subscription dropped, resubscribing", "addr", Redact(w.addr), "args", args, "err", err)
+				if sub = w.resubscribe(ctx, notifications, args...); sub == nil {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// resubscribe 按指数退避不断重新订阅，直到成功或ctx取消
+func (w *Ws) resubscribe(ctx context.Context, notifications chan json.RawMessage, args ...interface{}) *rpc.ClientSubscription {
+	interval := minResubscribeInterval
+	for {
+		sub, err := w.client.EthSubscribe(ctx, notifications, args...)
+		if err == nil {
+			log.Info(ctx, "resubscribe success", "addr", Redact(w.addr), "args", args)
+			return sub
+		}
+		log.Warn(ctx, "resubscribe failed", "addr", Redact(w.addr), "args", args, "err", err, "retry_after", interval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxResubscribeInterval {
+			interval = maxResubscribeInterval
+		}
+	}
+}
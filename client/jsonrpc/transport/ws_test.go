@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testSubService struct {
+	subscriptions int32
+}
+
+// NewHeads 每次订阅推送3个区块高度，第n次订阅推送 3n-2 到 3n
+func (s *testSubService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, _ := rpc.NotifierFromContext(ctx)
+	sub := notifier.CreateSubscription()
+	start := 3*int(atomic.AddInt32(&s.subscriptions, 1)) - 2
+	go func() {
+		for i := start; i < start+3; i++ {
+			_ = notifier.Notify(sub.ID, map[string]interface{}{"number": i})
+		}
+	}()
+	return sub, nil
+}
+
+// restartableHandler 重启时关闭旧server上的所有连接，新连接由新server处理
+type restartableHandler struct {
+	mu      sync.Mutex
+	server  *rpc.Server
+	service *testSubService
+}
+
+func (h *restartableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	server := h.server
+	h.mu.Unlock()
+	server.WebsocketHandler([]string{"*"}).ServeHTTP(w, r)
+}
+
+func (h *restartableHandler) restart(t *testing.T) {
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", h.service))
+	h.mu.Lock()
+	old := h.server
+	h.server = server
+	h.mu.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+func TestWs_Subscribe(t *testing.T) {
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", new(testSubService)))
+	httpServer := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer httpServer.Close()
+
+	ws, err := NewWs(context.Background(), "ws"+strings.TrimPrefix(httpServer.URL, "http"))
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch, err := ws.Subscribe(ctx, "newHeads")
+	assert.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		msg := <-ch
+		assert.JSONEq(t, fmt.Sprintf(`{"number":%d}`, i), string(msg))
+	}
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWs_resubscribe(t *testing.T) {
+	handler := &restartableHandler{service: new(testSubService)}
+	handler.restart(t)
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	ws, err := NewWs(context.Background(), "ws"+strings.TrimPrefix(httpServer.URL, "http"))
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch, err := ws.Subscribe(ctx, "newHeads")
+	assert.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		assert.JSONEq(t, fmt.Sprintf(`{"number":%d}`, i), string(<-ch))
+	}
+
+	// 节点断开连接后自动重连并重新订阅
+	handler.restart(t)
+	for i := 4; i <= 6; i++ {
+		assert.JSONEq(t, fmt.Sprintf(`{"number":%d}`, i), string(<-ch))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&handler.service.subscriptions))
+	cancel()
+	for range ch {
+	}
+}
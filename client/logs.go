@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"sort"
+	"sync"
+)
+
+// DefaultLogConcurrency FilterLogs 默认同时查询的子范围数
+const DefaultLogConcurrency = 4
+
+// FilterLogs 按区块范围查询日志，节点返回结果过多或范围超过限制时对半拆分后重新查询
+// 子范围并发查询，返回的日志按区块高度及日志序号排序
+func (e *Eth) FilterLogs(ctx context.Context, filter LogFilter) ([]*block.Log, error) {
+	from := filter.FromBlock
+	var to uint64
+	if filter.ToBlock != nil {
+		to = *filter.ToBlock
+	} else {
+		head, err := e.BlockNumber(ctx)
+		if err != nil {
+			return nil, err
+		}
+		to = head
+	}
+	if from > to {
+		return []*block.Log{}, nil
+	}
+	concurrency := e.logConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q := &logQuery{eth: e, filter: filter, limitCh: make(chan struct{}, concurrency), cancel: cancel, logs: make([]*block.Log, 0)}
+	size := e.logRange
+	if size == 0 {
+		size = to - from + 1
+	}
+	var wg sync.WaitGroup
+	for start := from; start <= to; start += size {
+		end := start + size - 1
+		if end > to || end < start {
+			end = to
+		}
+		wg.Add(1)
+		go q.run(ctx, &wg, start, end)
+		if end == to {
+			break
+		}
+	}
+	wg.Wait()
+	if q.err != nil {
+		return nil, q.err
+	}
+	sort.SliceStable(q.logs, func(i, j int) bool {
+		if q.logs[i].BlockNumber != q.logs[j].BlockNumber {
+			return q.logs[i].BlockNumber < q.logs[j].BlockNumber
+		}
+		return q.logs[i].LogIndex < q.logs[j].LogIndex
+	})
+	return q.logs, nil
+}
+
+// logQuery 一次 FilterLogs 的状态，任一子范围失败时取消其余查询
+type logQuery struct {
+	eth     *Eth
+	filter  LogFilter
+	limitCh chan struct{}
+	cancel  context.CancelFunc
+
+	mu   sync.Mutex
+	logs []*block.Log
+	err  error
+}
+
+func (q *logQuery) run(ctx context.Context, wg *sync.WaitGroup, from, to uint64) {
+	defer wg.Done()
+	logs, err := q.query(ctx, from, to)
+	if errors.Is(err, errs.LogRangeTooLarge) && from < to {
+		mid := from + (to-from)/2
+		wg.Add(2)
+		go q.run(ctx, wg, from, mid)
+		go q.run(ctx, wg, mid+1, to)
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil {
+		if q.err == nil {
+			q.err = err
+			q.cancel()
+		}
+		return
+	}
+	q.logs = append(q.logs, logs...)
+}
+
+func (q *logQuery) query(ctx context.Context, from, to uint64) ([]*block.Log, error) {
+	select {
+	case q.limitCh <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-q.limitCh
+	}()
+	logs := make([]*block.Log, 0)
+	err := q.eth.client.CallContext(ctx, "eth_getLogs", &logs, q.filter.rangeArg(from, to))
+	return logs, err
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/codec"
+	"github.com/taorzhang/toolkit/types/block"
+	"sync"
+	"testing"
+)
+
+// logsTransport 每个区块返回一条日志，查询范围超过limit时返回结果过多的错误
+type logsTransport struct {
+	head  uint64
+	limit uint64
+
+	mu     sync.Mutex
+	ranges [][2]uint64
+}
+
+func (l *logsTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if method == "eth_blockNumber" {
+		*result.(*math.HexOrDecimal64) = math.HexOrDecimal64(l.head)
+		return nil
+	}
+	arg := args[0].(map[string]interface{})
+	from, to := uint64(arg["fromBlock"].(math.HexOrDecimal64)), uint64(arg["toBlock"].(math.HexOrDecimal64))
+	l.mu.Lock()
+	l.ranges = append(l.ranges, [2]uint64{from, to})
+	l.mu.Unlock()
+	if to-from+1 > l.limit {
+		return &codec.ErrorObject{Code: -32005, Message: "query returned more than 10000 results"}
+	}
+	logs := make([]*block.Log, 0)
+	for number := to; number >= from && number <= to; number-- {
+		logs = append(logs, &block.Log{BlockNumber: math.HexOrDecimal64(number), Address: arg["address"].([]block.Address)[0]})
+	}
+	raw, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, result)
+}
+
+func (l *logsTransport) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for idx := range b {
+		b[idx].Error = l.CallContext(ctx, b[idx].Result, b[idx].Method, b[idx].Args...)
+	}
+	return nil
+}
+
+func (l *logsTransport) Close() error {
+	return nil
+}
+
+func TestEth_FilterLogs(t *testing.T) {
+	tr := &logsTransport{head: 99, limit: 16}
+	c, err := jsonrpc.NewClient(jsonrpc.WithSharedTransport("logs", tr), jsonrpc.WithRpcClose(), jsonrpc.WithMaxIdle(4), jsonrpc.WithMaxCap(4))
+	assert.NoError(t, err)
+	defer c.Release()
+	eth := NewEthClient(c, c, WithLogQuery(0, 4))
+
+	address := block.Hexstr2Address("0x00000000000000000000000000000000000000aa")
+	logs, err := eth.FilterLogs(context.Background(), LogFilter{Addresses: []block.Address{address}, FromBlock: 10})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 90)
+	for idx := range logs {
+		assert.Equal(t, uint64(10+idx), uint64(logs[idx].BlockNumber))
+		assert.Equal(t, address, logs[idx].Address)
+	}
+	for _, r := range tr.ranges {
+		assert.True(t, r[0] >= 10 && r[1] <= 99)
+	}
+
+	// 单个区块的结果仍然过多时返回错误
+	tr.limit = 0
+	_, err = eth.FilterLogs(context.Background(), LogFilter{Addresses: []block.Address{address}, FromBlock: 10, ToBlock: BlockHeight(11)})
+	assert.Error(t, err)
+
+	// 只查询创世区块
+	tr.limit, tr.ranges = 16, nil
+	logs, err = eth.FilterLogs(context.Background(), LogFilter{Addresses: []block.Address{address}, ToBlock: BlockHeight(0)})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, [][2]uint64{{0, 0}}, tr.ranges)
+}
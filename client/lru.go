@@ -0,0 +1,103 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// lru 定长的最近最少使用缓存
+type lru struct {
+	mu        sync.Mutex
+	size      int
+	items     map[string]*list.Element
+	order     *list.List
+	evictions uint64
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (l *lru) get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// add 返回本次淘汰的数量及当前的数量
+func (l *lru) add(key string, value interface{}) (evicted, entries int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[key]; ok {
+		elem.Value.(*lruEntry).value = value
+		l.order.MoveToFront(elem)
+		return 0, l.order.Len()
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry).key)
+		l.evictions++
+		evicted++
+	}
+	return evicted, l.order.Len()
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// flight 正在进行中的请求
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// flightGroup 相同key的并发请求只执行一次，其余请求共享结果
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do 每个调用方只等待自己的ctx，fn在后台执行，不会因为发起请求的调用方取消而中断其他调用方
+// shared 为true时表示结果来自其他正在进行中的请求
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, shared := g.flights[key]
+	if !shared {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+		go func() {
+			f.value, f.err = fn()
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+	select {
+	case <-f.done:
+		return f.value, f.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), shared
+	}
+}
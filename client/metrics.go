@@ -0,0 +1,39 @@
+package client
+
+import (
+	"github.com/taorzhang/toolkit/metrics"
+)
+
+// 缓存指标，通过 metrics.SetBackend 设置的实现记录，只记录设置了 WithCacheMetrics 的缓存
+var (
+	cacheRequests = metrics.NewCounterVec("client_cache_requests_total",
+		"CachedProvider lookups, result is hit, miss or shared (merged into an in-flight request).", "cache", "result")
+	cacheEvictions = metrics.NewCounterVec("client_cache_evictions_total",
+		"Entries evicted from the CachedProvider LRU.", "cache")
+	cacheEntries = metrics.NewGaugeVec("client_cache_entries",
+		"Entries currently in the CachedProvider LRU.", "cache")
+)
+
+// WithCacheMetrics 以name为label记录缓存的命中、淘汰及数量，指标中不会引用缓存本身
+func WithCacheMetrics(name string) CacheOpt {
+	return func(c *CachedProvider) {
+		c.metricsName = name
+	}
+}
+
+// observe 记录一次查询的结果: hit miss shared
+func (c *CachedProvider) observe(result string) {
+	if c.metricsName != "" {
+		cacheRequests.WithLabelValues(c.metricsName, result).Inc()
+	}
+}
+
+func (c *CachedProvider) observeEntries(evicted, entries int) {
+	if c.metricsName == "" {
+		return
+	}
+	if evicted > 0 {
+		cacheEvictions.WithLabelValues(c.metricsName).Add(float64(evicted))
+	}
+	cacheEntries.WithLabelValues(c.metricsName).Set(float64(entries))
+}
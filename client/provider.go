@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/taorzhang/toolkit/types/block"
 	"math/big"
 )
@@ -16,6 +17,7 @@ type Provider interface {
 	SendTx(ctx context.Context, signTx string) (result string, err error)
 	EstimateGas(ctx context.Context, call CallParameter) (*big.Int, error)
 	BalanceAt(ctx context.Context, address block.Address) (*big.Int, error)
+	BalanceAtHeight(ctx context.Context, address block.Address, height uint64) (*big.Int, error)
 	MethodCall(ctx context.Context, out interface{}, args ...interface{}) error
 	BlockByHash(ctx context.Context, hash block.Hash, full bool) (*block.Block, error)
 	BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error)
@@ -23,7 +25,12 @@ type Provider interface {
 	GetNonce(ctx context.Context, addr block.Address, status string) (nonce uint64, err error)
 	TransactionByHash(ctx context.Context, hash block.Hash, full bool) (*block.Transaction, error)
 	TransactionsByHashList(ctx context.Context, hash []block.Hash, full bool) ([]*block.Transaction, error)
+	FilterLogs(ctx context.Context, filter LogFilter) ([]*block.Log, error)
 	InternalTxs(ctx context.Context, txHashes []block.Hash, clientType EthClientType) (map[string][]*block.InternalTxCallTrace, error)
+	TraceBlocks(ctx context.Context, blocks []*block.Block, clientType EthClientType) error
+	SubscribeNewHeads(ctx context.Context) (<-chan *block.Block, error)
+	SubscribeLogs(ctx context.Context, filter LogFilter) (<-chan *block.Log, error)
+	SubscribePendingTransactions(ctx context.Context) (<-chan block.Hash, error)
 }
 
 var DefaultGasLimit = "0x30000"
@@ -58,3 +65,47 @@ func (c CallParameter) ToArg() interface{} {
 	}
 	return arg
 }
+
+// LogFilter 日志过滤条件
+// Topics 每一位之间为与关系，同一位内的多个topic为或关系，nil表示匹配任意topic
+type LogFilter struct {
+	Addresses []block.Address
+	Topics    [][]block.Hash
+	// FromBlock ToBlock 查询的区块范围(包含两端)，ToBlock为nil时查询到最新高度，只对 FilterLogs 生效
+	FromBlock uint64
+	ToBlock   *uint64
+}
+
+// BlockHeight 返回高度的指针，用于 LogFilter.ToBlock
+func BlockHeight(height uint64) *uint64 {
+	return &height
+}
+
+func (f LogFilter) ToArg() interface{} {
+	return f.toArg()
+}
+
+// rangeArg 指定区块范围的 eth_getLogs 参数
+func (f LogFilter) rangeArg(from, to uint64) interface{} {
+	arg := f.toArg()
+	arg["fromBlock"] = math.HexOrDecimal64(from)
+	arg["toBlock"] = math.HexOrDecimal64(to)
+	return arg
+}
+
+func (f LogFilter) toArg() map[string]interface{} {
+	arg := make(map[string]interface{})
+	if len(f.Addresses) > 0 {
+		arg["address"] = f.Addresses
+	}
+	if len(f.Topics) > 0 {
+		topics := make([]interface{}, len(f.Topics))
+		for idx := range f.Topics {
+			if len(f.Topics[idx]) > 0 {
+				topics[idx] = f.Topics[idx]
+			}
+		}
+		arg["topics"] = topics
+	}
+	return arg
+}
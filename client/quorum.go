@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// QuorumAnswer 单个节点的返回
+type QuorumAnswer struct {
+	Provider string
+	Value    interface{}
+	Err      error
+}
+
+// QuorumError 达成一致的节点数不足，包含每个节点的返回，errors.Is 可以判断 errs.QuorumNotReached
+type QuorumError struct {
+	Method  string
+	Quorum  int
+	Answers []QuorumAnswer
+}
+
+func (e *QuorumError) Error() string {
+	answers := make([]string, len(e.Answers))
+	for idx, answer := range e.Answers {
+		if answer.Err != nil {
+			answers[idx] = fmt.Sprintf("%s: error %v", answer.Provider, answer.Err)
+		} else {
+			answers[idx] = fmt.Sprintf("%s: %v", answer.Provider, answer.Value)
+		}
+	}
+	return fmt.Sprintf("%s: quorum %d not reached, answers: [%s]", e.Method, e.Quorum, strings.Join(answers, ", "))
+}
+
+func (e *QuorumError) Is(target error) bool {
+	return target == errs.QuorumNotReached
+}
+
+type QuorumOpt func(q *QuorumProvider)
+
+// WithQuorum 至少n个节点返回一致的结果，默认为多数
+func WithQuorum(n int) QuorumOpt {
+	return func(q *QuorumProvider) {
+		q.quorum = n
+	}
+}
+
+// WithProviderNames 节点名称，用于错误信息，默认为 provider-0、provider-1...
+func WithProviderNames(names ...string) QuorumOpt {
+	return func(q *QuorumProvider) {
+		copy(q.names, names)
+	}
+}
+
+// QuorumProvider 余额、区块、交易及回执、eth_call 同时请求多个节点，达到quorum个一致的结果才返回
+// 查询最新状态的方法先确定共同高度再按高度查询，避免各节点最新高度不同导致结果不一致，其余方法使用第一个节点
+type QuorumProvider struct {
+	Provider
+	providers []Provider
+	names     []string
+	quorum    int
+}
+
+func NewQuorumProvider(providers []Provider, opts ...QuorumOpt) (*QuorumProvider, error) {
+	if len(providers) == 0 {
+		return nil, errs.New(errs.InvalidParams, "providers is empty")
+	}
+	q := &QuorumProvider{Provider: providers[0], providers: providers, names: make([]string, len(providers)), quorum: len(providers)/2 + 1}
+	for idx := range q.names {
+		q.names[idx] = fmt.Sprintf("provider-%d", idx)
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.quorum <= 0 || q.quorum > len(providers) {
+		return nil, errs.New(errs.InvalidParams, fmt.Sprintf("quorum %d out of range [1, %d]", q.quorum, len(providers)))
+	}
+	return q, nil
+}
+
+type quorumResult struct {
+	idx   int
+	value interface{}
+	key   string
+	err   error
+}
+
+// read 并发请求所有节点，有quorum个结果的key相同时立即返回，取消其余请求
+func (q *QuorumProvider) read(ctx context.Context, method string, fetch func(ctx context.Context, p Provider) (interface{}, error), key func(v interface{}) string) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan quorumResult, len(q.providers))
+	for idx := range q.providers {
+		go func(idx int) {
+			v, err := fetch(ctx, q.providers[idx])
+			r := quorumResult{idx: idx, value: v, err: err}
+			if err == nil {
+				r.key = key(v)
+			}
+			results <- r
+		}(idx)
+	}
+	answers := make([]QuorumAnswer, len(q.providers))
+	votes := make(map[string]int)
+	for range q.providers {
+		r := <-results
+		answers[r.idx] = QuorumAnswer{Provider: q.names[r.idx], Value: r.value, Err: r.err}
+		if r.err != nil {
+			continue
+		}
+		votes[r.key]++
+		if votes[r.key] >= q.quorum {
+			return r.value, nil
+		}
+	}
+	return nil, &QuorumError{Method: method, Quorum: q.quorum, Answers: answers}
+}
+
+// commonHeight 同时查询所有节点的最新高度，返回至少quorum个节点已经达到的最高高度
+// 各节点的最新高度可能不同，"latest" 的查询需要固定在该高度上比较
+func (q *QuorumProvider) commonHeight(ctx context.Context) (uint64, error) {
+	type headResult struct {
+		idx  int
+		head uint64
+		err  error
+	}
+	results := make(chan headResult, len(q.providers))
+	for idx := range q.providers {
+		go func(idx int) {
+			head, err := q.providers[idx].BlockNumber(ctx)
+			results <- headResult{idx: idx, head: head, err: err}
+		}(idx)
+	}
+	answers := make([]QuorumAnswer, len(q.providers))
+	heads := make([]uint64, 0, len(q.providers))
+	for range q.providers {
+		r := <-results
+		answers[r.idx] = QuorumAnswer{Provider: q.names[r.idx], Value: r.head, Err: r.err}
+		if r.err == nil {
+			heads = append(heads, r.head)
+		}
+	}
+	if len(heads) < q.quorum {
+		return 0, &QuorumError{Method: "BlockNumber", Quorum: q.quorum, Answers: answers}
+	}
+	sort.Slice(heads, func(i, j int) bool { return heads[i] > heads[j] })
+	return heads[q.quorum-1], nil
+}
+
+// BalanceAt 先确定共同高度，再查询该高度的余额
+func (q *QuorumProvider) BalanceAt(ctx context.Context, address block.Address) (*big.Int, error) {
+	height, err := q.commonHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return q.BalanceAtHeight(ctx, address, height)
+}
+
+func (q *QuorumProvider) BalanceAtHeight(ctx context.Context, address block.Address, height uint64) (*big.Int, error) {
+	v, err := q.read(ctx, "BalanceAt", func(ctx context.Context, p Provider) (interface{}, error) {
+		return p.BalanceAtHeight(ctx, address, height)
+	}, func(v interface{}) string {
+		return v.(*big.Int).String()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*big.Int), nil
+}
+
+// BlockByNumber 按区块hash及交易回执的状态比较
+func (q *QuorumProvider) BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error) {
+	v, err := q.read(ctx, "BlockByNumber", func(ctx context.Context, p Provider) (interface{}, error) {
+		return p.BlockByNumber(ctx, height, full)
+	}, func(v interface{}) string {
+		b := v.(*block.Block)
+		key := b.Hash.String()
+		for _, tx := range b.Transactions {
+			key += "," + txKey(tx)
+		}
+		return key
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*block.Block), nil
+}
+
+// TransactionByHash 按所在区块及回执状态比较，确认充值时可以避免单个节点返回错误的回执
+func (q *QuorumProvider) TransactionByHash(ctx context.Context, hash block.Hash, full bool) (*block.Transaction, error) {
+	v, err := q.read(ctx, "TransactionByHash", func(ctx context.Context, p Provider) (interface{}, error) {
+		return p.TransactionByHash(ctx, hash, full)
+	}, func(v interface{}) string {
+		return txKey(v.(*block.Transaction))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*block.Transaction), nil
+}
+
+// MethodCall 每个节点的结果解码到独立的out副本，按json比较，达成一致后写入out
+// 未指定区块或者指定 "latest" 时固定在共同高度上调用
+func (q *QuorumProvider) MethodCall(ctx context.Context, out interface{}, args ...interface{}) error {
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return errs.New(errs.InvalidParams, "out must be a non-nil pointer")
+	}
+	if len(args) == 1 || (len(args) == 2 && args[1] == "latest") {
+		height, err := q.commonHeight(ctx)
+		if err != nil {
+			return err
+		}
+		args = []interface{}{args[0], hexutil.Uint64(height)}
+	}
+	v, err := q.read(ctx, "MethodCall", func(ctx context.Context, p Provider) (interface{}, error) {
+		result := reflect.New(outValue.Elem().Type())
+		if err := p.MethodCall(ctx, result.Interface(), args...); err != nil {
+			return nil, err
+		}
+		return result.Elem().Interface(), nil
+	}, func(v interface{}) string {
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	})
+	if err != nil {
+		return err
+	}
+	outValue.Elem().Set(reflect.ValueOf(v))
+	return nil
+}
+
+func txKey(tx *block.Transaction) string {
+	key := fmt.Sprintf("%s@%s#%d", tx.Hash, tx.BlockHash, uint64(tx.BlockNumber))
+	if tx.Receipt != nil {
+		key += fmt.Sprintf(":%d", uint64(tx.Receipt.Status))
+	}
+	return key
+}
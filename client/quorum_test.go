@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fixedProvider struct {
+	Provider
+	head    uint64
+	balance int64
+	result  string
+	err     error
+	// height 最近一次查询使用的高度
+	height uint64
+}
+
+func (p *fixedProvider) BlockNumber(ctx context.Context) (uint64, error) {
+	return p.head, p.err
+}
+
+func (p *fixedProvider) BalanceAtHeight(ctx context.Context, address block.Address, height uint64) (*big.Int, error) {
+	atomic.StoreUint64(&p.height, height)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return big.NewInt(p.balance), nil
+}
+
+func (p *fixedProvider) MethodCall(ctx context.Context, out interface{}, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	if height, ok := args[len(args)-1].(hexutil.Uint64); ok {
+		atomic.StoreUint64(&p.height, uint64(height))
+	}
+	*out.(*string) = p.result
+	return nil
+}
+
+func TestQuorumProvider(t *testing.T) {
+	ctx := context.Background()
+	down := errors.New("connection refused")
+	q, err := NewQuorumProvider([]Provider{
+		&fixedProvider{balance: 1, result: "0x1"},
+		&fixedProvider{balance: 2, result: "0x1"},
+		&fixedProvider{err: down},
+	}, WithProviderNames("a", "b", "c"))
+	assert.Nil(t, err)
+
+	var result string
+	assert.Nil(t, q.MethodCall(ctx, &result, "eth_call"))
+	assert.Equal(t, "0x1", result)
+
+	_, err = q.BalanceAt(ctx, block.Address{})
+	assert.ErrorIs(t, err, errs.QuorumNotReached)
+	var qe *QuorumError
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, "BalanceAt", qe.Method)
+	assert.Equal(t, 2, qe.Quorum)
+	assert.Equal(t, "a", qe.Answers[0].Provider)
+	assert.Equal(t, big.NewInt(1), qe.Answers[0].Value)
+	assert.Equal(t, big.NewInt(2), qe.Answers[1].Value)
+	assert.ErrorIs(t, qe.Answers[2].Err, down)
+
+	q, err = NewQuorumProvider([]Provider{&fixedProvider{balance: 1}, &fixedProvider{balance: 2}}, WithQuorum(1))
+	assert.Nil(t, err)
+	balance, err := q.BalanceAt(ctx, block.Address{})
+	assert.Nil(t, err)
+	assert.NotNil(t, balance)
+
+	_, err = NewQuorumProvider([]Provider{&fixedProvider{}}, WithQuorum(2))
+	assert.ErrorIs(t, err, errs.InvalidParams)
+}
+
+// pinned 所有节点都按height查询
+func pinned(providers []*fixedProvider, height uint64) bool {
+	for _, p := range providers {
+		if atomic.LoadUint64(&p.height) != height {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQuorumProvider_commonHeight(t *testing.T) {
+	ctx := context.Background()
+	providers := []*fixedProvider{{head: 10, balance: 1, result: "0x1"}, {head: 12, balance: 1, result: "0x1"}, {head: 11, balance: 1, result: "0x1"}}
+	q, err := NewQuorumProvider([]Provider{providers[0], providers[1], providers[2]})
+	assert.Nil(t, err)
+
+	// 两个节点已经达到高度11
+	balance, err := q.BalanceAt(ctx, block.Address{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), balance.Int64())
+	assert.Eventually(t, func() bool { return pinned(providers, 11) }, time.Second, time.Millisecond)
+
+	providers[0].head, providers[2].head = 12, 13
+	var result string
+	assert.Nil(t, q.MethodCall(ctx, &result, "eth_call", "latest"))
+	assert.Eventually(t, func() bool { return pinned(providers, 12) }, time.Second, time.Millisecond)
+
+	// 能返回高度的节点不足quorum
+	down := errors.New("connection refused")
+	q, err = NewQuorumProvider([]Provider{&fixedProvider{head: 1}, &fixedProvider{err: down}, &fixedProvider{err: down}})
+	assert.Nil(t, err)
+	_, err = q.BalanceAt(ctx, block.Address{})
+	assert.ErrorIs(t, err, errs.QuorumNotReached)
+	var qe *QuorumError
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, "BlockNumber", qe.Method)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+)
+
+// blockReceiptMethods 一次获取整个区块回执的方法，按顺序尝试，节点不支持的方法由 jsonrpc.Client 按节点记录
+var blockReceiptMethods = []string{"eth_getBlockReceipts", "parity_getBlockReceipts"}
+
+// fillReceipts 获取区块中所有交易的回执，节点支持时每个区块一个请求，不支持时尝试下一个方法
+// 回执数量或hash与区块中的交易不一致、请求失败时，该区块退化为逐笔获取回执
+func (e *Eth) fillReceipts(ctx context.Context, blocks []*block.Block) error {
+	pending := make([]*block.Block, 0, len(blocks))
+	for _, b := range blocks {
+		if len(b.Transactions) > 0 {
+			pending = append(pending, b)
+		}
+	}
+	fallback := make([]*block.Block, 0)
+	for _, method := range blockReceiptMethods {
+		if len(pending) == 0 {
+			break
+		}
+		if !e.client.Supports(method) {
+			continue
+		}
+		receipts := make([][]*block.Receipt, len(pending))
+		elems := make([]rpc.BatchElem, len(pending))
+		for idx := range pending {
+			elems[idx] = rpc.BatchElem{Method: method, Args: []interface{}{pending[idx].Number}, Result: &receipts[idx]}
+		}
+		// 失败的区块在后面逐笔获取，不需要在这里处理错误
+		_ = e.client.BatchCallContext(ctx, elems, false)
+		remaining := make([]*block.Block, 0)
+		for idx, b := range pending {
+			if errors.Is(elems[idx].Error, errs.MethodNotFound) {
+				remaining = append(remaining, b)
+				continue
+			}
+			if elems[idx].Error != nil {
+				fallback = append(fallback, b)
+				continue
+			}
+			if !matchReceipts(b, receipts[idx]) {
+				log.Warn(ctx, "block receipts mismatch, fetch receipts by transaction", "method", method, "block", uint64(b.Number), "txs", len(b.Transactions), "receipts", len(receipts[idx]))
+				fallback = append(fallback, b)
+				continue
+			}
+			for txIdx := range b.Transactions {
+				b.Transactions[txIdx].Receipt = receipts[idx][txIdx]
+			}
+		}
+		pending = remaining
+	}
+	var batch []rpc.BatchElem
+	for _, b := range append(fallback, pending...) {
+		for idx := range b.Transactions {
+			b.Transactions[idx].Receipt = new(block.Receipt)
+			batch = append(batch, rpc.BatchElem{
+				Method: "eth_getTransactionReceipt",
+				Args:   []interface{}{b.Transactions[idx].Hash},
+				Result: b.Transactions[idx].Receipt,
+			})
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return e.client.BatchCallContext(ctx, batch, true)
+}
+
+// matchReceipts 回执与区块中的交易按顺序一一对应，且属于该区块
+func matchReceipts(b *block.Block, receipts []*block.Receipt) bool {
+	if len(receipts) != len(b.Transactions) {
+		return false
+	}
+	for idx := range receipts {
+		if receipts[idx] == nil || receipts[idx].TransactionHash != b.Transactions[idx].Hash || receipts[idx].BlockHash != b.Hash {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,490 @@
+package simulated
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"strings"
+)
+
+const DefaultGasLimit = 30000000
+
+type Opt func(b *Backend)
+
+// WithAutoCommit 每发送一笔交易立即出块，使 wallet.Account 的连续操作可以依赖上一笔交易的结果
+func WithAutoCommit() Opt {
+	return func(b *Backend) {
+		b.autoCommit = true
+	}
+}
+
+// WithGasLimit 区块gas上限
+func WithGasLimit(gasLimit uint64) Opt {
+	return func(b *Backend) {
+		b.gasLimit = gasLimit
+	}
+}
+
+// Backend 基于 go-ethereum 模拟链实现的 client.Provider，会真正执行EVM字节码，用于合约相关的测试
+type Backend struct {
+	*backends.SimulatedBackend
+	autoCommit bool
+	gasLimit   uint64
+}
+
+var _ client.Provider = new(Backend)
+
+// New 创建模拟链，alloc为创世区块中账户的初始余额
+func New(alloc core.GenesisAlloc, opts ...Opt) *Backend {
+	b := &Backend{gasLimit: DefaultGasLimit}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.SimulatedBackend = backends.NewSimulatedBackend(alloc, b.gasLimit)
+	return b
+}
+
+func (b *Backend) signer() types.Signer {
+	return types.LatestSigner(b.Blockchain().Config())
+}
+
+// ChainID 模拟链的链ID固定为1337
+func (b *Backend) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(b.Blockchain().Config().ChainID), nil
+}
+
+func (b *Backend) BlockNumber(ctx context.Context) (uint64, error) {
+	return b.Blockchain().CurrentBlock().NumberU64(), nil
+}
+
+func (b *Backend) GasTipCap(ctx context.Context) (*big.Int, error) {
+	return b.SuggestGasTipCap(ctx)
+}
+
+func (b *Backend) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	return b.SuggestGasPrice(ctx)
+}
+
+// SendTx 发送签名交易，开启 WithAutoCommit 时交易立即被打包
+func (b *Backend) SendTx(ctx context.Context, signTx string) (string, error) {
+	raw, err := hexutil.Decode(signTx)
+	if err != nil {
+		return "", err
+	}
+	tx := new(types.Transaction)
+	if err = tx.UnmarshalBinary(raw); err != nil {
+		return "", err
+	}
+	if err = b.SendTransaction(ctx, tx); err != nil {
+		return "", errs.Classify(err)
+	}
+	if b.autoCommit {
+		b.Commit()
+	}
+	return tx.Hash().Hex(), nil
+}
+
+func (b *Backend) EstimateGas(ctx context.Context, call client.CallParameter) (*big.Int, error) {
+	gas, err := b.SimulatedBackend.EstimateGas(ctx, ethereum.CallMsg{
+		From:     call.From,
+		To:       call.To,
+		Gas:      call.Gas,
+		GasPrice: call.GasPrice,
+		Value:    call.Value,
+		Data:     call.Data,
+	})
+	if err != nil {
+		return nil, errs.Classify(err)
+	}
+	return new(big.Int).SetUint64(gas), nil
+}
+
+func (b *Backend) BalanceAt(ctx context.Context, address block.Address) (*big.Int, error) {
+	return b.SimulatedBackend.BalanceAt(ctx, *address.ToCommonAddress(), nil)
+}
+
+// BalanceAtHeight 模拟链只支持最新高度
+func (b *Backend) BalanceAtHeight(ctx context.Context, address block.Address, height uint64) (*big.Int, error) {
+	return b.SimulatedBackend.BalanceAt(ctx, *address.ToCommonAddress(), new(big.Int).SetUint64(height))
+}
+
+// callArgs eth_call 的参数，与 client.CallParameter.ToArg 的结果对应
+type callArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Data     hexutil.Bytes   `json:"data"`
+	Input    hexutil.Bytes   `json:"input"`
+}
+
+// MethodCall 与 eth_call 的参数一致，args[0]为调用参数，args[1]为区块，支持latest及pending
+func (b *Backend) MethodCall(ctx context.Context, out interface{}, args ...interface{}) error {
+	if len(args) == 0 {
+		return errs.New(errs.InvalidParams, "eth_call args is empty")
+	}
+	raw, err := json.Marshal(args[0])
+	if err != nil {
+		return err
+	}
+	var call callArgs
+	if err = json.Unmarshal(raw, &call); err != nil {
+		return err
+	}
+	msg := ethereum.CallMsg{From: call.From, To: call.To, Gas: uint64(call.Gas), Data: call.Data}
+	if len(call.Input) > 0 {
+		msg.Data = call.Input
+	}
+	if call.GasPrice != nil {
+		msg.GasPrice = call.GasPrice.ToInt()
+	}
+	if call.Value != nil {
+		msg.Value = call.Value.ToInt()
+	}
+	var result []byte
+	if len(args) > 1 && args[1] == "pending" {
+		result, err = b.PendingCallContract(ctx, msg)
+	} else {
+		result, err = b.CallContract(ctx, msg, nil)
+	}
+	if err != nil {
+		return errs.Classify(err)
+	}
+	// 与jsonrpc的返回保持一致，结果按json解码到out
+	encoded, err := json.Marshal(hexutil.Bytes(result))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+func (b *Backend) BlockByHash(ctx context.Context, hash block.Hash, full bool) (*block.Block, error) {
+	ethBlock, err := b.SimulatedBackend.BlockByHash(ctx, common.Hash(hash))
+	if err != nil {
+		return nil, err
+	}
+	return b.convertBlock(ctx, ethBlock, full)
+}
+
+func (b *Backend) BlockByNumber(ctx context.Context, height uint64, full bool) (*block.Block, error) {
+	ethBlock, err := b.SimulatedBackend.BlockByNumber(ctx, new(big.Int).SetUint64(height))
+	if err != nil {
+		return nil, err
+	}
+	return b.convertBlock(ctx, ethBlock, full)
+}
+
+func (b *Backend) BlocksByNumbers(ctx context.Context, heights []uint64, full bool) ([]*block.Block, error) {
+	blocks := make([]*block.Block, len(heights))
+	for idx := range heights {
+		data, err := b.BlockByNumber(ctx, heights[idx], full)
+		if err != nil {
+			return nil, err
+		}
+		blocks[idx] = data
+	}
+	return blocks, nil
+}
+
+func (b *Backend) GetNonce(ctx context.Context, addr block.Address, status string) (uint64, error) {
+	if strings.EqualFold(status, "pending") {
+		return b.PendingNonceAt(ctx, *addr.ToCommonAddress())
+	}
+	return b.NonceAt(ctx, *addr.ToCommonAddress(), nil)
+}
+
+func (b *Backend) TransactionByHash(ctx context.Context, hash block.Hash, full bool) (*block.Transaction, error) {
+	tx, pending, err := b.SimulatedBackend.TransactionByHash(ctx, common.Hash(hash))
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return b.convertTx(tx, nil, nil), nil
+	}
+	receipt, err := b.TransactionReceipt(ctx, common.Hash(hash))
+	if err != nil {
+		return nil, err
+	}
+	result := b.convertTx(tx, receipt, nil)
+	if full {
+		result.Receipt = b.convertReceipt(tx, receipt)
+	}
+	return result, nil
+}
+
+func (b *Backend) TransactionsByHashList(ctx context.Context, hashList []block.Hash, full bool) ([]*block.Transaction, error) {
+	txList := make([]*block.Transaction, len(hashList))
+	for idx := range hashList {
+		tx, err := b.TransactionByHash(ctx, hashList[idx], full)
+		if err != nil {
+			return nil, err
+		}
+		txList[idx] = tx
+	}
+	return txList, nil
+}
+
+// InternalTxs 模拟链不支持trace，没有交易时返回空
+func (b *Backend) InternalTxs(ctx context.Context, txHashes []block.Hash, clientType client.EthClientType) (map[string][]*block.InternalTxCallTrace, error) {
+	if len(txHashes) == 0 {
+		return make(map[string][]*block.InternalTxCallTrace), nil
+	}
+	return nil, errs.New(errs.InvalidParams, fmt.Sprintf("clientType [%s] is not support by simulated backend", clientType))
+}
+
+// TraceBlocks 模拟链不支持trace，区块中没有交易时不需要追踪
+func (b *Backend) TraceBlocks(ctx context.Context, blocks []*block.Block, clientType client.EthClientType) error {
+	for _, data := range blocks {
+		if len(data.Transactions) > 0 {
+			return errs.New(errs.InvalidParams, fmt.Sprintf("clientType [%s] is not support by simulated backend", clientType))
+		}
+	}
+	return nil
+}
+
+// SubscribeNewHeads 订阅新区块，区块中只有交易hash
+func (b *Backend) SubscribeNewHeads(ctx context.Context) (<-chan *block.Block, error) {
+	headers := make(chan *types.Header)
+	sub, err := b.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *block.Block)
+	go func() {
+		defer close(out)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.Err():
+				return
+			case header := <-headers:
+				ethBlock, err := b.SimulatedBackend.BlockByHash(ctx, header.Hash())
+				if err != nil {
+					continue
+				}
+				data, err := b.convertBlock(ctx, ethBlock, false)
+				if err != nil {
+					continue
+				}
+				select {
+				case out <- data:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// SubscribeLogs 订阅符合过滤条件的日志
+func (b *Backend) SubscribeLogs(ctx context.Context, filter client.LogFilter) (<-chan *block.Log, error) {
+	logs := make(chan types.Log)
+	sub, err := b.SubscribeFilterLogs(ctx, filterQuery(filter), logs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *block.Log)
+	go func() {
+		defer close(out)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.Err():
+				return
+			case l := <-logs:
+				select {
+				case out <- convertLog(&l):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// FilterLogs 查询区块范围内的日志，覆盖了 SimulatedBackend.FilterLogs，需要 bind 接口时使用 b.SimulatedBackend
+func (b *Backend) FilterLogs(ctx context.Context, filter client.LogFilter) ([]*block.Log, error) {
+	query := filterQuery(filter)
+	query.FromBlock = new(big.Int).SetUint64(filter.FromBlock)
+	if filter.ToBlock != nil {
+		query.ToBlock = new(big.Int).SetUint64(*filter.ToBlock)
+	}
+	logs, err := b.SimulatedBackend.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*block.Log, len(logs))
+	for idx := range logs {
+		result[idx] = convertLog(&logs[idx])
+	}
+	return result, nil
+}
+
+func filterQuery(filter client.LogFilter) ethereum.FilterQuery {
+	query := ethereum.FilterQuery{}
+	for _, address := range filter.Addresses {
+		query.Addresses = append(query.Addresses, *address.ToCommonAddress())
+	}
+	for _, topics := range filter.Topics {
+		var position []common.Hash
+		for _, topic := range topics {
+			position = append(position, common.Hash(topic))
+		}
+		query.Topics = append(query.Topics, position)
+	}
+	return query
+}
+
+// SubscribePendingTransactions 模拟链没有交易池，不支持订阅
+func (b *Backend) SubscribePendingTransactions(ctx context.Context) (<-chan block.Hash, error) {
+	return nil, errs.New(errs.InvalidParams, "pending transactions subscription is not support by simulated backend")
+}
+
+var errNilBlock = errors.New("block not found")
+
+func (b *Backend) convertBlock(ctx context.Context, ethBlock *types.Block, full bool) (*block.Block, error) {
+	if ethBlock == nil {
+		return nil, errNilBlock
+	}
+	header := ethBlock.Header()
+	data := &block.Block{
+		Hash:               block.Hash(ethBlock.Hash()),
+		ParentHash:         block.Hash(header.ParentHash),
+		Sha3Uncles:         block.Hash(header.UncleHash),
+		TransactionsRoot:   block.Hash(header.TxHash),
+		StateRoot:          block.Hash(header.Root),
+		ReceiptsRoot:       block.Hash(header.ReceiptHash),
+		Miner:              block.Address(header.Coinbase),
+		Difficulty:         (*block.BigInt)(new(big.Int).Set(header.Difficulty)),
+		ExtraData:          common.CopyBytes(header.Extra),
+		TransactionsHashes: make([]block.Hash, 0, len(ethBlock.Transactions())),
+		Uncles:             make([]block.Hash, 0),
+	}
+	data.Number = math.HexOrDecimal64(header.Number.Uint64())
+	data.GasLimit = math.HexOrDecimal64(header.GasLimit)
+	data.GasUsed = math.HexOrDecimal64(header.GasUsed)
+	data.Timestamp = math.HexOrDecimal64(header.Time)
+	if header.BaseFee != nil {
+		data.BaseFeePerGas = (*block.BigInt)(new(big.Int).Set(header.BaseFee))
+	}
+	for _, tx := range ethBlock.Transactions() {
+		data.TransactionsHashes = append(data.TransactionsHashes, block.Hash(tx.Hash()))
+		if !full {
+			continue
+		}
+		receipt, err := b.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		data.Transactions = append(data.Transactions, b.convertTx(tx, receipt, header.BaseFee))
+		data.Transactions[len(data.Transactions)-1].Receipt = b.convertReceipt(tx, receipt)
+	}
+	return data, nil
+}
+
+// convertTx receipt为空时表示交易还未被打包
+func (b *Backend) convertTx(tx *types.Transaction, receipt *types.Receipt, baseFee *big.Int) *block.Transaction {
+	from, _ := types.Sender(b.signer(), tx)
+	v, r, s := tx.RawSignatureValues()
+	data := &block.Transaction{
+		Hash:               block.Hash(tx.Hash()),
+		From:               block.Address(from),
+		Input:              common.CopyBytes(tx.Data()),
+		Value:              (*block.BigInt)(new(big.Int).Set(tx.Value())),
+		R:                  r.Bytes(),
+		S:                  s.Bytes(),
+		InternalTraceCalls: make([]*block.InternalTxCallTrace, 0),
+	}
+	data.Type = math.HexOrDecimal64(uint64(tx.Type()))
+	data.Gas = math.HexOrDecimal64(tx.Gas())
+	data.Nonce = math.HexOrDecimal64(tx.Nonce())
+	data.GasPrice = math.HexOrDecimal64(tx.GasPrice().Uint64())
+	data.V = math.HexOrDecimal256(*v)
+	if tx.To() != nil {
+		to := block.Address(*tx.To())
+		data.To = &to
+	}
+	if receipt != nil {
+		data.BlockHash = block.Hash(receipt.BlockHash)
+		data.BlockNumber = math.HexOrDecimal64(receipt.BlockNumber.Uint64())
+		data.TransactionIndex = math.HexOrDecimal64(uint64(receipt.TransactionIndex))
+	}
+	if tx.Type() != types.LegacyTxType {
+		chainID := math.HexOrDecimal64(tx.ChainId().Uint64())
+		data.ChainID = &chainID
+		for _, tuple := range tx.AccessList() {
+			entry := block.AccessEntry{Address: block.Address(tuple.Address)}
+			for _, key := range tuple.StorageKeys {
+				entry.Storage = append(entry.Storage, block.Hash(key))
+			}
+			data.AccessList = append(data.AccessList, entry)
+		}
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		data.MaxFeePerGas = (*block.BigInt)(new(big.Int).Set(tx.GasFeeCap()))
+		data.MaxPriorityFeePerGas = (*block.BigInt)(new(big.Int).Set(tx.GasTipCap()))
+		if baseFee != nil {
+			// 已打包的1559交易返回实际的gas price
+			price := new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
+			data.GasPrice = math.HexOrDecimal64(price.Uint64())
+		}
+	}
+	return data
+}
+
+func (b *Backend) convertReceipt(tx *types.Transaction, receipt *types.Receipt) *block.Receipt {
+	from, _ := types.Sender(b.signer(), tx)
+	data := &block.Receipt{
+		TransactionHash: block.Hash(receipt.TxHash),
+		ContractAddress: block.Address(receipt.ContractAddress),
+		BlockHash:       block.Hash(receipt.BlockHash),
+		From:            block.Address(from),
+		LogsBloom:       receipt.Bloom.Bytes(),
+		Logs:            make([]*block.Log, 0, len(receipt.Logs)),
+	}
+	data.TransactionIndex = math.HexOrDecimal64(uint64(receipt.TransactionIndex))
+	data.BlockNumber = math.HexOrDecimal64(receipt.BlockNumber.Uint64())
+	data.GasUsed = math.HexOrDecimal64(receipt.GasUsed)
+	data.CumulativeGasUsed = math.HexOrDecimal64(receipt.CumulativeGasUsed)
+	data.Status = math.HexOrDecimal64(receipt.Status)
+	for _, l := range receipt.Logs {
+		data.Logs = append(data.Logs, convertLog(l))
+	}
+	return data
+}
+
+func convertLog(l *types.Log) *block.Log {
+	data := &block.Log{
+		Removed:         l.Removed,
+		TransactionHash: block.Hash(l.TxHash),
+		BlockHash:       block.Hash(l.BlockHash),
+		Address:         block.Address(l.Address),
+		Data:            common.CopyBytes(l.Data),
+	}
+	data.LogIndex = math.HexOrDecimal64(uint64(l.Index))
+	data.TransactionIndex = math.HexOrDecimal64(uint64(l.TxIndex))
+	data.BlockNumber = math.HexOrDecimal64(l.BlockNumber)
+	for _, topic := range l.Topics {
+		data.Topics = append(data.Topics, block.Hash(topic))
+	}
+	return data
+}
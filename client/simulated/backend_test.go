@@ -0,0 +1,169 @@
+package simulated
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/abi"
+	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"github.com/taorzhang/toolkit/wallet"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+const contracts = "../../tests/wallets/contracts/"
+
+// readBin 读取 tests/wallets/contracts 下编译好的合约字节码
+func readBin(t *testing.T, path string) string {
+	content, err := os.ReadFile(contracts + path)
+	assert.NoError(t, err)
+	return strings.TrimSpace(string(content))
+}
+
+func newAccounts(t *testing.T, count int) (*Backend, []*wallet.Account) {
+	keys := make([]*ecdsa.PrivateKey, count)
+	alloc := core.GenesisAlloc{}
+	for idx := range keys {
+		key, err := crypto.GenerateKey()
+		assert.NoError(t, err)
+		keys[idx] = key
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: big.NewInt(1e18)}
+	}
+	backend := New(alloc, WithAutoCommit())
+	t.Cleanup(func() { _ = backend.Close() })
+	accounts := make([]*wallet.Account, count)
+	for idx := range keys {
+		accounts[idx] = &wallet.Account{PrivateKey: keys[idx], Client: backend}
+	}
+	return backend, accounts
+}
+
+func deploy(t *testing.T, backend *Backend, account *wallet.Account, bin string) block.Address {
+	hash, contract, err := account.DeployContractByCreate(bin)
+	assert.NoError(t, err)
+	tx, err := backend.TransactionByHash(context.Background(), *hash, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), uint64(tx.Receipt.Status))
+	assert.Equal(t, contract.Hex(), strings.ToLower(tx.Receipt.ContractAddress.String()))
+	return tx.Receipt.ContractAddress
+}
+
+func erc20Balance(t *testing.T, backend *Backend, contract, owner block.Address) *big.Int {
+	method, err := abi.NewMethod("function balanceOf(address)")
+	assert.NoError(t, err)
+	data, err := method.Encode([]interface{}{owner.String()})
+	assert.NoError(t, err)
+	var result string
+	err = backend.MethodCall(context.Background(), &result, client.CallParameter{To: contract.ToCommonAddress(), Data: data}.ToArg(), "latest")
+	assert.NoError(t, err)
+	balance, err := block.HexStrToBigInt(result)
+	assert.NoError(t, err)
+	return balance
+}
+
+func TestBackend_erc20(t *testing.T) {
+	backend, accounts := newAccounts(t, 2)
+	owner, spender := accounts[0], accounts[1]
+	contract := deploy(t, backend, owner, readBin(t, "erc20/output/ERC20.bin"))
+	ownerAddress := block.Hexstr2Address(owner.Address())
+	spenderAddress := block.Hexstr2Address(spender.Address())
+	receiver := block.Hexstr2Address("0x00000000000000000000000000000000000000aa")
+
+	_, err := owner.MintErc20Token(contract, "100")
+	assert.NoError(t, err)
+	_, err = owner.SendErc20Token(contract, receiver, "1.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "1500000000000000000", erc20Balance(t, backend, contract, receiver).String())
+
+	_, err = owner.ApprovalErc20Token(contract, spenderAddress, "10")
+	assert.NoError(t, err)
+	_, err = spender.TransferFromErc20Token(contract, ownerAddress, receiver, "2.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "4000000000000000000", erc20Balance(t, backend, contract, receiver).String())
+	assert.Equal(t, "96000000000000000000", erc20Balance(t, backend, contract, ownerAddress).String())
+
+	transfer := block.Hash(crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")))
+	logs, err := backend.FilterLogs(context.Background(), client.LogFilter{Addresses: []block.Address{contract}, Topics: [][]block.Hash{{transfer}}})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 3)
+	for idx := range logs {
+		assert.Equal(t, contract, logs[idx].Address)
+		assert.Equal(t, transfer, logs[idx].Topics[0])
+	}
+
+	// 超过授权额度
+	_, err = spender.TransferFromErc20Token(contract, ownerAddress, receiver, "8")
+	assert.Error(t, err)
+
+	// 余额不足时合约revert
+	method, err := abi.NewMethod("function transfer(address,uint256)")
+	assert.NoError(t, err)
+	data, err := method.Encode([]interface{}{ownerAddress.String(), "1000000000000000000000"})
+	assert.NoError(t, err)
+	_, err = backend.EstimateGas(context.Background(), client.CallParameter{From: *spenderAddress.ToCommonAddress(), To: contract.ToCommonAddress(), Data: data})
+	assert.ErrorIs(t, err, errs.ExecutionReverted)
+}
+
+func TestBackend_erc721(t *testing.T) {
+	backend, accounts := newAccounts(t, 1)
+	owner := accounts[0]
+	contract := deploy(t, backend, owner, readBin(t, "erc721/output/MqyFT.bin"))
+	receiver := block.Hexstr2Address("0x00000000000000000000000000000000000000bb")
+
+	method, err := abi.NewMethod("function mint(address _to, uint256 _tokenId, string _uri)")
+	assert.NoError(t, err)
+	txData, err := owner.CreateLegacyTxData(wallet.Pending, contract, big.NewInt(0), method, owner.Address(), big.NewInt(4), "https://example.com/4")
+	assert.NoError(t, err)
+	signedTx, err := owner.SignTx(txData)
+	assert.NoError(t, err)
+	_, err = backend.SendTx(context.Background(), signedTx)
+	assert.NoError(t, err)
+
+	hash, err := owner.SendErc721(contract, receiver, big.NewInt(4))
+	assert.NoError(t, err)
+	b, err := backend.BlockByNumber(context.Background(), 3, true)
+	assert.NoError(t, err)
+	assert.Equal(t, *hash, b.Transactions[0].Hash)
+	assert.Equal(t, uint64(1), uint64(b.Transactions[0].Receipt.Status))
+	assert.Len(t, b.Transactions[0].Receipt.Logs, 1)
+
+	ownerOf, err := abi.NewMethod("function ownerOf(uint256 _tokenId)")
+	assert.NoError(t, err)
+	data, err := ownerOf.Encode([]interface{}{big.NewInt(4)})
+	assert.NoError(t, err)
+	var result string
+	err = backend.MethodCall(context.Background(), &result, client.CallParameter{To: contract.ToCommonAddress(), Data: data}.ToArg(), "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, common.BytesToAddress(receiver[:]), common.HexToAddress(result))
+}
+
+func TestBackend_block(t *testing.T) {
+	ctx := context.Background()
+	backend, accounts := newAccounts(t, 1)
+	empty, err := backend.BlockByNumber(ctx, 0, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, empty.BaseFeePerGas, "london blocks carry the base fee")
+	assert.True(t, empty.BaseFeePerGas.ToBigInt().Sign() > 0)
+
+	// 没有需要追踪的交易时不报错
+	assert.NoError(t, backend.TraceBlocks(ctx, nil, client.GethType))
+	assert.NoError(t, backend.TraceBlocks(ctx, []*block.Block{empty}, client.GethType))
+	internalTxs, err := backend.InternalTxs(ctx, nil, client.GethType)
+	assert.NoError(t, err)
+	assert.Empty(t, internalTxs)
+
+	_, err = accounts[0].SendNativeToken(block.Hexstr2Address("0x00000000000000000000000000000000000000aa"), big.NewInt(1))
+	assert.NoError(t, err)
+	head, err := backend.BlockNumber(ctx)
+	assert.NoError(t, err)
+	mined, err := backend.BlockByNumber(ctx, head, true)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, backend.TraceBlocks(ctx, []*block.Block{mined}, client.GethType), errs.InvalidParams)
+}
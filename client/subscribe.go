@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/logs"
+	"github.com/taorzhang/toolkit/types/block"
+	"time"
+)
+
+const (
+	// maxBackfillHeads 断线重连后最多补齐的区块数
+	maxBackfillHeads = 128
+	// backfillRetries 补齐区块头失败后的重试次数
+	backfillRetries = 3
+	// backfillRetryInterval 补齐区块头的首次重试间隔，之后按2倍递增
+	backfillRetryInterval = 200 * time.Millisecond
+)
+
+var (
+	log = logs.NewLogger("module", "client")
+)
+
+// SubscribeNewHeads 订阅新区块头，断线重连后补齐断线期间遗漏的区块头
+// 补齐失败时暂不推送当前区块头，下一个区块头到达时重新补齐，保证区块头不遗漏且按高度顺序推送
+// ctx取消后关闭返回的channel
+func (e *Eth) SubscribeNewHeads(ctx context.Context) (<-chan *block.Block, error) {
+	notifications, err := e.subscribe(ctx, "newHeads")
+	if err != nil {
+		return nil, err
+	}
+	heads := make(chan *block.Block)
+	go func() {
+		defer close(heads)
+		var last uint64
+		for msg := range notifications {
+			head := new(block.Block)
+			if err := json.Unmarshal(msg, head); err != nil {
+				log.Warn(ctx, "unmarshal new head failed", "err", err)
+				continue
+			}
+			number := uint64(head.Number)
+			if last > 0 && number > last+1 {
+				missed, err := e.backfillHeads(ctx, last+1, number)
+				if err != nil {
+					log.Warn(ctx, "backfill heads failed, retry on next head", "from", last+1, "to", number, "err", err)
+					continue
+				}
+				for _, missed := range missed {
+					if !emit(ctx, heads, missed) {
+						return
+					}
+				}
+			}
+			if !emit(ctx, heads, head) {
+				return
+			}
+			last = number
+		}
+	}()
+	return heads, nil
+}
+
+// SubscribeLogs 订阅符合条件的日志
+func (e *Eth) SubscribeLogs(ctx context.Context, filter LogFilter) (<-chan *block.Log, error) {
+	notifications, err := e.subscribe(ctx, "logs", filter.ToArg())
+	if err != nil {
+		return nil, err
+	}
+	logCh := make(chan *block.Log)
+	go func() {
+		defer close(logCh)
+		for msg := range notifications {
+			l := new(block.Log)
+			if err := json.Unmarshal(msg, l); err != nil {
+				log.Warn(ctx, "unmarshal log failed", "err", err)
+				continue
+			}
+			if !emit(ctx, logCh, l) {
+				return
+			}
+		}
+	}()
+	return logCh, nil
+}
+
+// SubscribePendingTransactions 订阅进入交易池的交易hash
+func (e *Eth) SubscribePendingTransactions(ctx context.Context) (<-chan block.Hash, error) {
+	notifications, err := e.subscribe(ctx, "newPendingTransactions")
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(chan block.Hash)
+	go func() {
+		defer close(hashes)
+		for msg := range notifications {
+			var hash block.Hash
+			if err := json.Unmarshal(msg, &hash); err != nil {
+				log.Warn(ctx, "unmarshal pending transaction failed", "err", err)
+				continue
+			}
+			if !emit(ctx, hashes, hash) {
+				return
+			}
+		}
+	}()
+	return hashes, nil
+}
+
+func (e *Eth) subscribe(ctx context.Context, args ...interface{}) (<-chan json.RawMessage, error) {
+	if e.ws == nil {
+		return nil, errs.New(errs.InvalidParams, "websocket transport is not configured")
+	}
+	return e.ws.Subscribe(ctx, args...)
+}
+
+// backfillHeads 获取[from, to)区间内的区块头，失败后按指数退避重试
+func (e *Eth) backfillHeads(ctx context.Context, from, to uint64) ([]*block.Block, error) {
+	if to-from > maxBackfillHeads {
+		from = to - maxBackfillHeads
+	}
+	heights := make([]uint64, 0, to-from)
+	for height := from; height < to; height++ {
+		heights = append(heights, height)
+	}
+	interval := backfillRetryInterval
+	for attempt := 0; ; attempt++ {
+		blocks, err := e.BlocksByNumbers(ctx, heights, false)
+		if err == nil || attempt >= backfillRetries {
+			return blocks, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// emit 写入channel，ctx取消时返回false
+func emit[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
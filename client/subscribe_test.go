@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc/transport"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gapService 推送的区块头中间缺少3、4，前failures次查询区块失败
+type gapService struct {
+	failures int32
+}
+
+func (s *gapService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, _ := rpc.NotifierFromContext(ctx)
+	sub := notifier.CreateSubscription()
+	go func() {
+		for _, number := range []uint64{1, 2, 5} {
+			_ = notifier.Notify(sub.ID, map[string]interface{}{"number": hexutil.Uint64(number)})
+		}
+	}()
+	return sub, nil
+}
+
+func (s *gapService) GetBlockByNumber(number hexutil.Uint64, full bool) (map[string]interface{}, error) {
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		return nil, errors.New("backend unavailable")
+	}
+	return map[string]interface{}{"number": number}, nil
+}
+
+func TestEth_SubscribeNewHeads_backfill(t *testing.T) {
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", &gapService{failures: 1}))
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	wsServer := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer wsServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, err := transport.NewWs(ctx, "ws"+strings.TrimPrefix(wsServer.URL, "http"))
+	assert.NoError(t, err)
+	defer ws.Close()
+	rpcClient, err := jsonrpc.NewClient(jsonrpc.GetDefaultOpts(httpServer.URL)...)
+	assert.NoError(t, err)
+	defer rpcClient.Release()
+	eth := NewEthClient(rpcClient, rpcClient, WithWs(ws))
+
+	heads, err := eth.SubscribeNewHeads(ctx)
+	assert.NoError(t, err)
+	// 首次补齐失败后重试，缺少的区块头按顺序推送
+	for number := uint64(1); number <= 5; number++ {
+		head := <-heads
+		if assert.NotNil(t, head) {
+			assert.Equal(t, number, uint64(head.Number))
+		}
+	}
+	cancel()
+	for range heads {
+	}
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+)
+
+// GethTxTrace debug_traceBlockByHash 返回的单笔交易trace，旧版本geth不返回TxHash，按交易顺序对应
+type GethTxTrace struct {
+	TxHash block.Hash    `json:"txHash"`
+	Result GethCallFrame `json:"result"`
+	Error  string        `json:"error"`
+}
+
+// TraceBlocks 按区块追踪内部交易，每个区块一个请求，结果追加到区块中交易的 InternalTraceCalls
+// 只处理包含完整交易的区块，没有交易的区块不发送请求
+// 单个区块追踪失败时按交易重新追踪该区块(InternalTxs)，区块已被回滚(hash不一致)时返回 errs.BlockHashMismatch
+func (e *Eth) TraceBlocks(ctx context.Context, blocks []*block.Block, clientType EthClientType) error {
+	traced := make([]*block.Block, 0, len(blocks))
+	for _, b := range blocks {
+		if len(b.Transactions) > 0 {
+			traced = append(traced, b)
+		}
+	}
+	if len(traced) == 0 {
+		return nil
+	}
+	var (
+		results []map[string][]*block.InternalTxCallTrace
+		err     error
+	)
+	switch clientType {
+	case ErigonType:
+		results, err = e.erigonTraceBlocks(ctx, traced)
+	case GethType:
+		results, err = e.gethTraceBlocks(ctx, traced)
+	default:
+		return fmt.Errorf("clientType [%s] is not support", clientType)
+	}
+	if err != nil {
+		return err
+	}
+	for idx, b := range traced {
+		result := results[idx]
+		if result == nil {
+			if result, err = e.traceBlockTxs(ctx, b, clientType); err != nil {
+				return err
+			}
+		}
+		attachTraces(b, result)
+	}
+	return nil
+}
+
+// traceBlockTxs 按交易追踪区块中的所有交易
+func (e *Eth) traceBlockTxs(ctx context.Context, b *block.Block, clientType EthClientType) (map[string][]*block.InternalTxCallTrace, error) {
+	txHashes := make([]block.Hash, 0, len(b.Transactions))
+	for _, tx := range b.Transactions {
+		txHashes = append(txHashes, tx.Hash)
+	}
+	result, err := e.InternalTxs(ctx, txHashes, clientType)
+	if err != nil {
+		return nil, fmt.Errorf("trace block %d by transactions: %w", uint64(b.Number), err)
+	}
+	// 交易已被打包到其他区块
+	for _, traces := range result {
+		for _, trace := range traces {
+			if len(trace.BlockHash) > 0 && !bytes.Equal(trace.BlockHash, b.Hash.Bytes()) {
+				return nil, errs.New(errs.BlockHashMismatch, fmt.Sprintf("block %d hash is %s, transaction %s is in block %s", uint64(b.Number), b.Hash, trace.TxHash, trace.BlockHash))
+			}
+		}
+	}
+	return result, nil
+}
+
+// batchTrace 发送批量请求，只有请求无法完成(如ctx取消)时返回错误，单个元素的错误保留在 BatchElem.Error
+func (e *Eth) batchTrace(ctx context.Context, elems []rpc.BatchElem) error {
+	err := e.internalTxClient.BatchCallContext(ctx, elems, false)
+	var batchErr *jsonrpc.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return err
+	}
+	return nil
+}
+
+// erigonTraceBlocks trace_block 只支持区块高度，返回的 blockHash 与区块不一致说明区块已被回滚
+// 追踪失败的区块结果为nil
+func (e *Eth) erigonTraceBlocks(ctx context.Context, blocks []*block.Block) ([]map[string][]*block.InternalTxCallTrace, error) {
+	elems := make([]rpc.BatchElem, 0, len(blocks))
+	traces := make([][]ErigonCallerTrace, len(blocks))
+	for idx := range blocks {
+		traces[idx] = make([]ErigonCallerTrace, 0)
+		elems = append(elems, rpc.BatchElem{
+			Method: "trace_block",
+			Args:   []interface{}{blocks[idx].Number},
+			Result: &traces[idx],
+		})
+	}
+	if err := e.batchTrace(ctx, elems); err != nil {
+		return nil, err
+	}
+	results := make([]map[string][]*block.InternalTxCallTrace, len(blocks))
+	for idx, b := range blocks {
+		if elems[idx].Error != nil {
+			log.Warn(ctx, "trace block failed, trace by transactions", "block", uint64(b.Number), "err", elems[idx].Error)
+			continue
+		}
+		for _, trace := range traces[idx] {
+			if len(trace.BlockHash) > 0 && !bytes.Equal(trace.BlockHash, b.Hash.Bytes()) {
+				return nil, errs.New(errs.BlockHashMismatch, fmt.Sprintf("block %d hash is %s, trace_block returned %s", uint64(b.Number), b.Hash, trace.BlockHash))
+			}
+		}
+		results[idx] = make(map[string][]*block.InternalTxCallTrace)
+		appendErigonTraces(results[idx], traces[idx])
+	}
+	return results, nil
+}
+
+// gethTraceBlocks 按区块hash追踪，区块被回滚后追踪的仍是该区块
+// 追踪失败、trace数量与交易数不一致或者有交易追踪失败的区块结果为nil
+func (e *Eth) gethTraceBlocks(ctx context.Context, blocks []*block.Block) ([]map[string][]*block.InternalTxCallTrace, error) {
+	elems := make([]rpc.BatchElem, 0, len(blocks))
+	traces := make([][]GethTxTrace, len(blocks))
+	for idx := range blocks {
+		traces[idx] = make([]GethTxTrace, 0)
+		elems = append(elems, rpc.BatchElem{
+			Method: "debug_traceBlockByHash",
+			Args:   []interface{}{blocks[idx].Hash, gethCallTracer},
+			Result: &traces[idx],
+		})
+	}
+	if err := e.batchTrace(ctx, elems); err != nil {
+		return nil, err
+	}
+	results := make([]map[string][]*block.InternalTxCallTrace, len(blocks))
+	for idx, b := range blocks {
+		result, err := gethBlockTraces(b, traces[idx], elems[idx].Error)
+		if err != nil {
+			log.Warn(ctx, "trace block failed, trace by transactions", "block", uint64(b.Number), "err", err)
+			continue
+		}
+		results[idx] = result
+	}
+	return results, nil
+}
+
+func gethBlockTraces(b *block.Block, traces []GethTxTrace, err error) (map[string][]*block.InternalTxCallTrace, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(traces) != len(b.Transactions) {
+		return nil, fmt.Errorf("block %d has %d transactions but %d traces", uint64(b.Number), len(b.Transactions), len(traces))
+	}
+	result := make(map[string][]*block.InternalTxCallTrace)
+	for txIdx := range traces {
+		txTrace := &traces[txIdx]
+		txHash := txTrace.TxHash
+		if txHash == (block.Hash{}) {
+			txHash = b.Transactions[txIdx].Hash
+		}
+		if txTrace.Error != "" {
+			return nil, fmt.Errorf("trace transaction %s failed: %s", txHash, txTrace.Error)
+		}
+		calls := make([]*block.InternalTxCallTrace, 0)
+		flattenGethFrame(&txTrace.Result, block.Hex(txHash.Bytes()), []int{}, false, &calls)
+		for _, call := range calls {
+			call.BlockHash = b.Hash.Bytes()
+			call.BlockNumber = uint64(b.Number)
+		}
+		result[txHash.String()] = calls
+	}
+	return result, nil
+}
+
+// attachTraces 按交易hash把trace追加到区块中的交易
+func attachTraces(b *block.Block, traces map[string][]*block.InternalTxCallTrace) {
+	for _, tx := range b.Transactions {
+		if calls, ok := traces[tx.Hash.String()]; ok {
+			tx.InternalTraceCalls = append(tx.InternalTraceCalls, calls...)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package errs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// 节点返回的常见错误，使用 errors.Is 判断
+var (
+	NonceTooLow            = errors.New("nonce too low")
+	NonceTooHigh           = errors.New("nonce too high")
+	ReplacementUnderpriced = errors.New("replacement transaction underpriced")
+	InsufficientFunds      = errors.New("insufficient funds")
+	ExecutionReverted      = errors.New("execution reverted")
+	GasTooLow              = errors.New("gas too low")
+	RateLimited            = errors.New("rate limited")
+	MethodNotFound         = errors.New("method not found")
+	BlockNotFound          = errors.New("block not found")
+	MissingTrieNode        = errors.New("missing trie node")
+	// LogRangeTooLarge eth_getLogs 结果过多或区块范围超过节点限制，缩小范围后可以重试
+	LogRangeTooLarge = errors.New("log query range too large")
+)
+
+const (
+	codeMethodNotFound    = -32601
+	codeExecutionReverted = 3
+	// codeLimitExceeded infura等节点超出请求额度
+	codeLimitExceeded = -32005
+)
+
+// rpcMessages 错误码无法区分时按错误信息分类，匹配时忽略大小写，靠前的优先
+// 只使用各节点完整的错误信息，避免 "revert"、"block range" 等片段误判
+var rpcMessages = []struct {
+	kind     error
+	messages []string
+}{
+	{NonceTooLow, []string{"nonce too low", "nonce is too low"}},
+	{NonceTooHigh, []string{"nonce too high", "nonce is too high", "nonce has max value"}},
+	{ReplacementUnderpriced, []string{"replacement transaction underpriced", "replacement fee too low", "replacement underpriced"}},
+	{InsufficientFunds, []string{"insufficient funds for", "insufficient balance for"}},
+	{GasTooLow, []string{"intrinsic gas too low", "gas required exceeds allowance"}},
+	{ExecutionReverted, []string{"execution reverted", "vm execution error"}},
+	{LogRangeTooLarge, []string{
+		"query returned more than",        // geth、infura
+		"log response size exceeded",      // alchemy
+		"eth_getlogs is limited to a",     // quicknode
+		"exceed maximum block range",      // bsc
+		"block range is too wide",         // ankr
+		"block range too large",           // erigon
+		"logs matched by query exceeds",   // blast
+		"query exceeds max block range",   // nodereal
+		"query exceeds max results limit", // nodereal
+	}},
+	{RateLimited, []string{"rate limit exceeded", "too many requests", "request limit exceeded", "exceeded the quota", "daily request count exceeded"}},
+	{MethodNotFound, []string{"method not found", "does not exist/is not available", "method not supported", "unsupported method"}},
+	{MissingTrieNode, []string{"missing trie node", "historical state not available", "state not available", "state is not available"}},
+	{BlockNotFound, []string{"header not found", "block not found", "unknown block"}},
+}
+
+// RpcError 分类后的节点错误，errors.Is 可以判断错误类型，errors.As 可以取到原始错误
+type RpcError struct {
+	// Kind 错误类型，如 NonceTooLow
+	Kind  error
+	Code  int
+	Data  interface{}
+	cause error
+}
+
+func (e *RpcError) Error() string {
+	return e.cause.Error()
+}
+
+// Is 判断错误类型
+func (e *RpcError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *RpcError) Unwrap() error {
+	return e.cause
+}
+
+// ErrorCode 实现 rpc.Error
+func (e *RpcError) ErrorCode() int {
+	return e.Code
+}
+
+// ErrorData 实现 rpc.DataError
+func (e *RpcError) ErrorData() interface{} {
+	return e.Data
+}
+
+// RevertData 合约revert时返回的数据
+func (e *RpcError) RevertData() []byte {
+	if e.Kind != ExecutionReverted {
+		return nil
+	}
+	switch data := e.Data.(type) {
+	case string:
+		b, err := hexutil.Decode(data)
+		if err != nil {
+			return nil
+		}
+		return b
+	case []byte:
+		return data
+	}
+	return nil
+}
+
+// RevertReason 解析 Error(string) 及 Panic(uint256)，无法解析时返回空
+func (e *RpcError) RevertReason() string {
+	return UnpackRevert(e.RevertData())
+}
+
+// statusError 携带http状态码的错误，如 transport.RetryAfterError
+type statusError interface {
+	HTTPStatusCode() int
+}
+
+// Classify 将节点返回的错误转换为 *RpcError，无法识别的错误原样返回
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var rpcErr *RpcError
+	if errors.As(err, &rpcErr) {
+		return err
+	}
+	classified := &RpcError{cause: err}
+	var codeErr rpc.Error
+	if errors.As(err, &codeErr) {
+		classified.Code = codeErr.ErrorCode()
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		classified.Data = dataErr.ErrorData()
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		classified.Kind = RateLimited
+		return classified
+	}
+	var statusErr statusError
+	if errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusTooManyRequests {
+		classified.Kind = RateLimited
+		return classified
+	}
+	switch classified.Code {
+	case codeMethodNotFound:
+		classified.Kind = MethodNotFound
+	case codeExecutionReverted:
+		classified.Kind = ExecutionReverted
+	case codeLimitExceeded:
+		// 部分节点查询日志结果过多时也返回该错误码
+		if classifyMessage(err.Error()) != LogRangeTooLarge {
+			classified.Kind = RateLimited
+		}
+	}
+	if classified.Kind == nil {
+		classified.Kind = classifyMessage(err.Error())
+	}
+	if classified.Kind == nil {
+		return err
+	}
+	return classified
+}
+
+func classifyMessage(message string) error {
+	message = strings.ToLower(message)
+	for _, rule := range rpcMessages {
+		for _, msg := range rule.messages {
+			if strings.Contains(message, msg) {
+				return rule.kind
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	panicSelector  = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// UnpackRevert 按abi解析revert数据，支持 Error(string) 及 Panic(uint256)，无法解析时返回空
+func UnpackRevert(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	selector, body := data[:4], data[4:]
+	switch {
+	case string(selector) == string(revertSelector):
+		if len(body) < 64 {
+			return ""
+		}
+		// 比较时不做加法，避免超大的offset、size溢出
+		offset := new(big.Int).SetBytes(body[:32])
+		if !offset.IsUint64() || offset.Uint64() > uint64(len(body))-32 {
+			return ""
+		}
+		start := offset.Uint64() + 32
+		size := new(big.Int).SetBytes(body[start-32 : start])
+		if !size.IsUint64() || size.Uint64() > uint64(len(body))-start {
+			return ""
+		}
+		return string(body[start : start+size.Uint64()])
+	case string(selector) == string(panicSelector):
+		if len(body) < 32 {
+			return ""
+		}
+		return fmt.Sprintf("panic: 0x%x", binary.BigEndian.Uint64(body[24:32]))
+	}
+	return ""
+}
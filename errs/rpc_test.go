@@ -0,0 +1,115 @@
+package errs
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// codeError 模拟节点返回的jsonrpc错误
+type codeError struct {
+	code    int
+	message string
+	data    interface{}
+}
+
+func (e *codeError) Error() string          { return e.message }
+func (e *codeError) ErrorCode() int         { return e.code }
+func (e *codeError) ErrorData() interface{} { return e.data }
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{&codeError{code: -32000, message: "nonce too low: next nonce 5, tx nonce 3"}, NonceTooLow},
+		{&codeError{code: -32000, message: "replacement transaction underpriced"}, ReplacementUnderpriced},
+		{&codeError{code: -32000, message: "insufficient funds for gas * price + value"}, InsufficientFunds},
+		{&codeError{code: -32000, message: "intrinsic gas too low"}, GasTooLow},
+		{&codeError{code: -32000, message: "header not found"}, BlockNotFound},
+		{&codeError{code: -32000, message: "missing trie node 4f2a (path )"}, MissingTrieNode},
+		{&codeError{code: -32601, message: "the method eth_foo does not exist/is not available"}, MethodNotFound},
+		{&codeError{code: -32005, message: "daily request count exceeded"}, RateLimited},
+		{&codeError{code: -32005, message: "query returned more than 10000 results"}, LogRangeTooLarge},
+		{&codeError{code: -32602, message: "eth_getLogs is limited to a 10,000 block range"}, LogRangeTooLarge},
+		{&codeError{code: 3, message: "execution reverted"}, ExecutionReverted},
+		{rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, RateLimited},
+		{fmt.Errorf("send tx: %w", &codeError{code: -32000, message: "Nonce Too High"}), NonceTooHigh},
+	}
+	for _, c := range cases {
+		err := Classify(c.err)
+		assert.True(t, errors.Is(err, c.kind), "%v", c.err)
+		assert.Equal(t, c.err.Error(), err.Error())
+		// 原始错误仍然可以取到
+		var codeErr rpc.Error
+		assert.True(t, errors.As(err, &codeErr))
+	}
+
+	unknown := &codeError{code: -32000, message: "something went wrong"}
+	assert.Equal(t, error(unknown), Classify(unknown))
+	// 只包含部分关键字的错误不分类
+	for _, message := range []string{
+		"invalid block range params",
+		"contract reverted the transfer",
+		"out of gas",
+		"gas limit exceeded",
+	} {
+		err := &codeError{code: -32000, message: message}
+		assert.Equal(t, error(err), Classify(err), message)
+	}
+	assert.Nil(t, Classify(nil))
+}
+
+func TestRpcError_RevertReason(t *testing.T) {
+	// Error("not owner")
+	data := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000009" +
+		"6e6f74206f776e65720000000000000000000000000000000000000000000000"
+	var rpcErr *RpcError
+	assert.True(t, errors.As(Classify(&codeError{code: 3, message: "execution reverted: not owner", data: data}), &rpcErr))
+	assert.Equal(t, "not owner", rpcErr.RevertReason())
+
+	// Panic(0x11) 算术溢出
+	data = "0x4e487b71" + "0000000000000000000000000000000000000000000000000000000000000011"
+	assert.True(t, errors.As(Classify(&codeError{code: 3, message: "execution reverted", data: data}), &rpcErr))
+	assert.Equal(t, "panic: 0x11", rpcErr.RevertReason())
+}
+
+func TestUnpackRevert(t *testing.T) {
+	word := func(hex string) string {
+		return strings.Repeat("0", 64-len(hex)) + hex
+	}
+	message := "6e6f74206f776e65720000000000000000000000000000000000000000000000"
+	cases := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"error", "08c379a0" + word("20") + word("9") + message, "not owner"},
+		{"empty message", "08c379a0" + word("20") + word("0"), ""},
+		{"panic", "4e487b71" + word("11"), "panic: 0x11"},
+		{"short selector", "08c379", ""},
+		{"unknown selector", "deadbeef" + word("20") + word("9") + message, ""},
+		{"short body", "08c379a0" + word("20"), ""},
+		{"short panic", "4e487b71" + "11", ""},
+		{"offset out of range", "08c379a0" + word("40") + word("9"), ""},
+		{"offset max uint64", "08c379a0" + word("ffffffffffffffff") + word("9") + message, ""},
+		{"offset above uint64", "08c379a0" + strings.Repeat("f", 64) + word("9") + message, ""},
+		{"size out of range", "08c379a0" + word("20") + word("21") + message, ""},
+		{"size max uint64", "08c379a0" + word("20") + word("ffffffffffffffff") + message, ""},
+		{"size overflow offset", "08c379a0" + word("20") + word("ffffffffffffffe0") + message, ""},
+		{"size above uint64", "08c379a0" + word("20") + strings.Repeat("f", 64) + message, ""},
+	}
+	for _, c := range cases {
+		data, err := hex.DecodeString(c.data)
+		assert.NoError(t, err, c.name)
+		assert.NotPanics(t, func() {
+			assert.Equal(t, c.want, UnpackRevert(data), c.name)
+		}, c.name)
+	}
+}
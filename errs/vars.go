@@ -9,4 +9,7 @@ var (
 	InvalidInitComponent     = errors.New("invalid init component")
 	FatalInvalid             = errors.New("fatal error")
 	MaxRetryPollingBatchCall = errors.New("max retry polling batch call")
+	ChainIDMismatch          = errors.New("chain id mismatch")
+	QuorumNotReached         = errors.New("quorum not reached")
+	BlockHashMismatch        = errors.New("block hash mismatch")
 )
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// Memory 在内存中记录指标的值，用于测试及调试，不提供导出格式
+type Memory struct {
+	mu     sync.Mutex
+	values map[string]float64
+	counts map[string]uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{values: make(map[string]float64), counts: make(map[string]uint64)}
+}
+
+// Value counter、gauge的当前值，直方图为观测值之和
+func (m *Memory) Value(name string, values ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[seriesKey(name, values)]
+}
+
+// Count 直方图的观测次数
+func (m *Memory) Count(name string, values ...string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[seriesKey(name, values)]
+}
+
+func (m *Memory) Counter(name, _ string, _ []string) func(values ...string) Counter {
+	return func(values ...string) Counter {
+		return &memorySeries{m: m, key: seriesKey(name, values)}
+	}
+}
+
+func (m *Memory) Gauge(name, _ string, _ []string) func(values ...string) Gauge {
+	return func(values ...string) Gauge {
+		return &memorySeries{m: m, key: seriesKey(name, values)}
+	}
+}
+
+func (m *Memory) Histogram(name, _ string, _ []float64, _ []string) func(values ...string) Observer {
+	return func(values ...string) Observer {
+		return &memorySeries{m: m, key: seriesKey(name, values)}
+	}
+}
+
+// seriesKey label值中不会出现的分隔符
+func seriesKey(name string, values []string) string {
+	return name + "\xff" + strings.Join(values, "\xff")
+}
+
+type memorySeries struct {
+	m   *Memory
+	key string
+}
+
+func (s *memorySeries) Inc() {
+	s.Add(1)
+}
+
+func (s *memorySeries) Dec() {
+	s.Add(-1)
+}
+
+func (s *memorySeries) Add(delta float64) {
+	s.m.mu.Lock()
+	s.m.values[s.key] += delta
+	s.m.mu.Unlock()
+}
+
+func (s *memorySeries) Set(v float64) {
+	s.m.mu.Lock()
+	s.m.values[s.key] = v
+	s.m.mu.Unlock()
+}
+
+func (s *memorySeries) Observe(v float64) {
+	s.m.mu.Lock()
+	s.m.values[s.key] += v
+	s.m.counts[s.key]++
+	s.m.mu.Unlock()
+}
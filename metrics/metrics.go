@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DefaultBuckets 默认的直方图分桶，单位秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Counter 只增不减的计数，prometheus.Counter 满足该接口
+type Counter interface {
+	Inc()
+	Add(delta float64)
+}
+
+// Gauge 可增可减的瞬时值，prometheus.Gauge 满足该接口
+type Gauge interface {
+	Set(v float64)
+	Add(delta float64)
+	Inc()
+	Dec()
+}
+
+// Observer 按分桶统计观测值，prometheus.Observer 满足该接口
+type Observer interface {
+	Observe(v float64)
+}
+
+// Backend 指标的实现，本包不负责导出，使用 prometheus/client_golang 时:
+//
+//	func (promBackend) Counter(name, help string, labels []string) func(values ...string) metrics.Counter {
+//		vec := promauto.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+//		return func(values ...string) metrics.Counter { return vec.WithLabelValues(values...) }
+//	}
+//
+// 每个指标只会创建一次，返回的函数按label值取得样本
+type Backend interface {
+	Counter(name, help string, labels []string) func(values ...string) Counter
+	Gauge(name, help string, labels []string) func(values ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels []string) func(values ...string) Observer
+}
+
+// Discard 丢弃所有指标，未调用 SetBackend 时使用
+var Discard Backend = discard{}
+
+var current = struct {
+	mu      sync.RWMutex
+	backend Backend
+	// gen 每次 SetBackend 加1，指标据此重新创建
+	gen uint64
+}{backend: Discard}
+
+// SetBackend 设置指标的实现，为空时使用 Discard，已定义的指标在下次记录时切换到新的实现
+func SetBackend(b Backend) {
+	if b == nil {
+		b = Discard
+	}
+	current.mu.Lock()
+	current.backend = b
+	current.gen++
+	current.mu.Unlock()
+}
+
+func backend() (Backend, uint64) {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	return current.backend, current.gen
+}
+
+// vec 指标的定义，记录时由当前的 Backend 创建
+type vec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu   sync.Mutex
+	gen  uint64
+	with interface{}
+}
+
+func (v *vec) resolve(values []string, create func(b Backend) interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expect %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	b, gen := backend()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.with == nil || v.gen != gen {
+		v.with, v.gen = create(b), gen
+	}
+	return v.with
+}
+
+// Name 指标名称
+func (v *vec) Name() string {
+	return v.name
+}
+
+type CounterVec struct {
+	vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec: vec{name: name, help: help, labels: labels}}
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) Counter {
+	with := c.resolve(values, func(b Backend) interface{} {
+		return b.Counter(c.name, c.help, c.labels)
+	})
+	return with.(func(values ...string) Counter)(values...)
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{vec: vec{name: name, help: help, labels: labels}}
+}
+
+func (g *GaugeVec) WithLabelValues(values ...string) Gauge {
+	with := g.resolve(values, func(b Backend) interface{} {
+		return b.Gauge(g.name, g.help, g.labels)
+	})
+	return with.(func(values ...string) Gauge)(values...)
+}
+
+type HistogramVec struct {
+	vec
+}
+
+// NewHistogramVec buckets为空时使用 DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{vec: vec{name: name, help: help, labels: labels, buckets: append([]float64(nil), buckets...)}}
+}
+
+func (h *HistogramVec) WithLabelValues(values ...string) Observer {
+	with := h.resolve(values, func(b Backend) interface{} {
+		return b.Histogram(h.name, h.help, h.buckets, h.labels)
+	})
+	return with.(func(values ...string) Observer)(values...)
+}
+
+type discard struct{}
+
+func (discard) Counter(string, string, []string) func(values ...string) Counter {
+	return func(...string) Counter { return nop{} }
+}
+
+func (discard) Gauge(string, string, []string) func(values ...string) Gauge {
+	return func(...string) Gauge { return nop{} }
+}
+
+func (discard) Histogram(string, string, []float64, []string) func(values ...string) Observer {
+	return func(...string) Observer { return nop{} }
+}
+
+type nop struct{}
+
+func (nop) Inc()            {}
+func (nop) Dec()            {}
+func (nop) Add(float64)     {}
+func (nop) Set(float64)     {}
+func (nop) Observe(float64) {}
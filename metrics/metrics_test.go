@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// countingBackend 记录每个指标被创建的次数
+type countingBackend struct {
+	*Memory
+	created map[string]int
+}
+
+func (c *countingBackend) Counter(name, help string, labels []string) func(values ...string) Counter {
+	c.created[name]++
+	return c.Memory.Counter(name, help, labels)
+}
+
+func TestSetBackend(t *testing.T) {
+	defer SetBackend(nil)
+	requests := NewCounterVec("requests_total", "Requests.", "method")
+	inflight := NewGaugeVec("inflight", "In flight requests.")
+	latency := NewHistogramVec("latency_seconds", "Latency.", nil, "method")
+
+	// 未设置时丢弃
+	requests.WithLabelValues("eth_call").Inc()
+	assert.Panics(t, func() { requests.WithLabelValues() })
+
+	backend := &countingBackend{Memory: NewMemory(), created: make(map[string]int)}
+	SetBackend(backend)
+	requests.WithLabelValues("eth_call").Add(2)
+	requests.WithLabelValues("eth_call").Inc()
+	requests.WithLabelValues("eth_blockNumber").Inc()
+	inflight.WithLabelValues().Inc()
+	inflight.WithLabelValues().Dec()
+	inflight.WithLabelValues().Set(5)
+	latency.WithLabelValues("eth_call").Observe(0.5)
+	latency.WithLabelValues("eth_call").Observe(3)
+
+	assert.Equal(t, 1, backend.created["requests_total"], "each metric is created once per backend")
+	assert.Equal(t, float64(3), backend.Value("requests_total", "eth_call"))
+	assert.Equal(t, float64(1), backend.Value("requests_total", "eth_blockNumber"))
+	assert.Equal(t, float64(5), backend.Value("inflight"))
+	assert.Equal(t, 3.5, backend.Value("latency_seconds", "eth_call"))
+	assert.Equal(t, uint64(2), backend.Count("latency_seconds", "eth_call"))
+	assert.Equal(t, DefaultBuckets, latency.buckets)
+
+	// 切换后重新创建
+	next := NewMemory()
+	SetBackend(next)
+	requests.WithLabelValues("eth_call").Inc()
+	assert.Equal(t, float64(1), next.Value("requests_total", "eth_call"))
+	assert.Equal(t, float64(3), backend.Value("requests_total", "eth_call"))
+}
@@ -1,6 +1,8 @@
 package polling
 
 import (
+	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/types/block"
 	"strings"
 	"time"
 )
@@ -31,14 +33,52 @@ type Config struct {
 	// Concurrency 并发
 	Concurrency         uint
 	QuitWaitingDuration time.Duration
+	// BlockTime 追上最新高度后等待出块的间隔
+	BlockTime time.Duration
+	// Confirmations 只拉取落后最新高度该确认数的区块，避免拉到被回滚的区块
+	Confirmations uint64
+	// InternalClientType 获取内部交易使用的trace方式
+	InternalClientType client.EthClientType
+	// TraceFilter 保留的内部交易，为空时使用 DefaultTraceFilter，需要完整调用树时使用 KeepAllTraces
+	TraceFilter block.TraceFilter
+}
+
+// DefaultTraceFilter 保留原生币转账及合约创建，与只记录这两类内部交易时的输出一致
+var DefaultTraceFilter = block.AnyOf(block.ValueTransfers, block.Creations)
+
+// KeepAllTraces 保留完整的调用树
+func KeepAllTraces(*block.InternalTxCallTrace) bool {
+	return true
 }
 
 func NewLinerConfig() *Config {
-	return &Config{ItemLen: 100, Step: 8, Concurrency: 1, Mode: LinearMode, QuitWaitingDuration: 10 * time.Second}
+	return &Config{ItemLen: 100, Step: 8, Concurrency: 1, Mode: LinearMode, QuitWaitingDuration: 10 * time.Second, BlockTime: time.Second, InternalClientType: client.GethType}
 }
 
 func NewChaseConfig() *Config {
-	return &Config{ItemLen: 100, Step: 16, Concurrency: 3, Mode: ChaseMode, QuitWaitingDuration: 30 * time.Second}
+	return &Config{ItemLen: 100, Step: 16, Concurrency: 3, Mode: ChaseMode, QuitWaitingDuration: 30 * time.Second, BlockTime: time.Second, InternalClientType: client.GethType}
 }
 
 type CfgOpt func(c *Config) error
+
+// WithChain 按链的元数据设置出块间隔、确认数及trace方式
+func WithChain(chain client.Chain) CfgOpt {
+	return func(c *Config) error {
+		if chain.BlockTime > 0 {
+			c.BlockTime = chain.BlockTime
+		}
+		c.Confirmations = chain.FinalityDepth
+		if chain.TraceType != "" {
+			c.InternalClientType = chain.TraceType
+		}
+		return nil
+	}
+}
+
+// WithTraceFilter 设置保留的内部交易
+func WithTraceFilter(filter block.TraceFilter) CfgOpt {
+	return func(c *Config) error {
+		c.TraceFilter = filter
+		return nil
+	}
+}
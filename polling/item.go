@@ -15,10 +15,27 @@ type Item struct {
 	end                uint
 	skipInternal       bool
 	internalClientType client.EthClientType
+	traceFilter        block.TraceFilter
 }
 
-func NewItem(ctx context.Context, client client.Provider, start, end uint, skipInternal bool, internalClientType client.EthClientType) *Item {
-	return &Item{ctx: ctx, blocks: make([]*block.Block, 0), start: start, end: end, client: client, skipInternal: skipInternal, internalClientType: internalClientType, cancel: false}
+type ItemOpt func(i *Item)
+
+// WithItemTraceFilter 设置保留的内部交易，同 Config.TraceFilter
+func WithItemTraceFilter(filter block.TraceFilter) ItemOpt {
+	return func(i *Item) {
+		if filter != nil {
+			i.traceFilter = filter
+		}
+	}
+}
+
+// NewItem 默认使用 DefaultTraceFilter 过滤内部交易
+func NewItem(ctx context.Context, client client.Provider, start, end uint, skipInternal bool, internalClientType client.EthClientType, opts ...ItemOpt) *Item {
+	item := &Item{ctx: ctx, blocks: make([]*block.Block, 0), start: start, end: end, client: client, skipInternal: skipInternal, internalClientType: internalClientType, traceFilter: DefaultTraceFilter, cancel: false}
+	for _, opt := range opts {
+		opt(item)
+	}
+	return item
 }
 
 func NewCancelItem(ctx context.Context) *Item {
@@ -38,21 +55,19 @@ func (i *Item) Retrieve() error {
 		i.blocks = append(i.blocks, blocks...)
 		return nil
 	}
-	var txHashes []block.Hash
-	for idx := range blocks {
-		txHashes = append(txHashes, blocks[idx].Hash)
-	}
-	internalTxs, err := i.client.InternalTxs(i.ctx, txHashes, i.internalClientType)
-	if err != nil {
+	if err = i.client.TraceBlocks(i.ctx, blocks, i.internalClientType); err != nil {
 		return err
 	}
-	for blockIdx := range blocks {
-		for txIdx := range blocks[blockIdx].Transactions {
-			if internalCallTraces, ok := internalTxs[blocks[blockIdx].Transactions[txIdx].Hash.String()]; ok {
-				blocks[blockIdx].Transactions[txIdx].InternalTraceCalls = append(blocks[blockIdx].Transactions[txIdx].InternalTraceCalls, internalCallTraces...)
-			}
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			tx.InternalTraceCalls = block.FilterTraces(tx.InternalTraceCalls, i.traceFilter)
 		}
 	}
 	i.blocks = append(i.blocks, blocks...)
 	return nil
 }
+
+// Blocks Retrieve 获取到的区块
+func (i *Item) Blocks() []*block.Block {
+	return i.blocks
+}
@@ -25,6 +25,15 @@ func NewPipeline(c *Config, opts ...CfgOpt) (*Pipeline, error) {
 			return nil, err
 		}
 	}
+	if c.BlockTime <= 0 {
+		c.BlockTime = time.Second
+	}
+	if c.InternalClientType == "" {
+		c.InternalClientType = client.GethType
+	}
+	if c.TraceFilter == nil {
+		c.TraceFilter = DefaultTraceFilter
+	}
 	return &Pipeline{items: make(chan *Item, c.ItemLen), cancel: make(chan bool), config: c}, nil
 }
 
@@ -39,7 +48,7 @@ func (p *Pipeline) isQuit() bool {
 }
 
 // NextBlockHeights 下一次polling动作
-func (p *Pipeline) NextBlockHeights(start uint64) *NextPollingAction {
+func (p *Pipeline) NextBlockHeights(ctx context.Context, start uint64) *NextPollingAction {
 	var iStart, iEnd = start, start + uint64(p.config.Step)
 	if p.config.Mode.IsChase() {
 		if iStart >= p.config.End {
@@ -50,10 +59,12 @@ func (p *Pipeline) NextBlockHeights(start uint64) *NextPollingAction {
 		}
 		return NewNextPollingAction(iStart, iEnd, ContinuePolling)
 	}
-	nodeHeight, err := p.client.BlockNumber(context.Background())
-	if err != nil {
+	nodeHeight, err := p.client.BlockNumber(ctx)
+	if err != nil || nodeHeight <= p.config.Confirmations {
 		return NewNextPollingAction(iStart, iEnd, WaitingBlocks)
 	}
+	// 只拉取已达到确认数的区块
+	nodeHeight -= p.config.Confirmations
 	if iStart >= nodeHeight {
 		return NewNextPollingAction(iStart, iEnd, WaitingBlocks)
 	}
@@ -93,10 +104,10 @@ func (p *Pipeline) Run(ctx context.Context) {
 					<-time.After(time.Second)
 					break
 				}
-				nextAction := p.NextBlockHeights(blockHeight)
+				nextAction := p.NextBlockHeights(ctx, blockHeight)
 				if nextAction.IsWaiting() {
 					// 等待出块
-					<-time.After(time.Second)
+					<-time.After(p.config.BlockTime)
 					break
 				}
 				if nextAction.IsDone() {
@@ -113,7 +124,7 @@ func (p *Pipeline) Run(ctx context.Context) {
 						<-limitCh
 					}()
 					// pulling data and send to pipeline
-					pollingItem(m, n)
+					pollingItem(ctx, m, n)
 				}(nextAction.StartHeight(), nextAction.EndHeight())
 			}
 		}
@@ -124,4 +135,4 @@ func (p *Pipeline) Run(ctx context.Context) {
 
 func doItem(item *Item) {}
 
-func pollingItem(iStart, iEnd uint64) {}
+func pollingItem(ctx context.Context, iStart, iEnd uint64) {}
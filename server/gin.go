@@ -1,6 +1,10 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/taorzhang/toolkit/errs"
+	"net/http"
+)
 
 type GinOpt func(gin *gin.Engine) error
 
@@ -14,3 +18,14 @@ func NewGin(mode string, opts ...GinOpt) (*gin.Engine, error) {
 	}
 	return g, nil
 }
+
+// WithMetrics 在path上暴露指标，handler由指标的实现提供，如 promhttp.Handler()
+func WithMetrics(path string, handler http.Handler) GinOpt {
+	return func(g *gin.Engine) error {
+		if handler == nil {
+			return errs.New(errs.InvalidParams, "metrics handler is nil")
+		}
+		g.GET(path, gin.WrapH(handler))
+		return nil
+	}
+}
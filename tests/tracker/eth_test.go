@@ -2,105 +2,102 @@ package tracker
 
 import (
 	"context"
-	"fmt"
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/assert"
 	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/client/fakenode"
 	jsonrpc2 "github.com/taorzhang/toolkit/client/jsonrpc"
 	"github.com/taorzhang/toolkit/types/block"
+	"github.com/taorzhang/toolkit/wallet"
+	"math/big"
 	"testing"
 	"time"
 )
 
-// initArbTracker 初始化arb tracker
-func initArbTracker(t *testing.T) client.Provider {
-	opts := jsonrpc2.GetEthCfgOpts(
-		"https://arbitrum-mainnet.token.im", 5, 100, 20, 5*time.Second)
-	c, err := jsonrpc2.NewClient(
-		opts...)
+// initEthTracker 初始化连接到本地 fakenode 的tracker，不访问网络
+func initEthTracker(t *testing.T) (*fakenode.Node, client.Provider, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
 	assert.NoError(t, err)
-	return client.NewEthClient(c, nil)
-}
-
-// initEthTracker 初始化eth tracker
-func initEthTracker(t *testing.T) client.Provider {
-	opts := jsonrpc2.GetEthCfgOpts(
-		"https://mainnet-eth.token.im", 5, 100, 20, 5*time.Second)
+	node, err := fakenode.New(fakenode.WithAlloc(map[common.Address]*big.Int{crypto.PubkeyToAddress(key.PublicKey): big.NewInt(1e18)}))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = node.Close() })
+	opts := jsonrpc2.GetEthCfgOpts(node.URL(), 5, 100, 20, 5*time.Second)
 	c, err := jsonrpc2.NewClient(
 		opts...)
 	assert.NoError(t, err)
-	return client.NewEthClient(c, nil)
+	t.Cleanup(c.Release)
+	return node, client.NewEthClient(c, c), key
 }
 
-func initEthInternalTracker(t *testing.T) client.Provider {
-	opts := jsonrpc2.GetEthCfgOpts("http://goerli.testnet.private:8080/openethereum", 5, 20, 5, 5*time.Second)
-	c, err := jsonrpc2.NewClient(
-		opts...)
-	assert.NoError(t, err)
+// sendNative 发送一笔原生币转账并出块
+func sendNative(t *testing.T, node *fakenode.Node, provider client.Provider, key *ecdsa.PrivateKey, value int64) *block.Hash {
+	account := &wallet.Account{PrivateKey: key, Client: provider}
+	hash, err := account.SendNativeToken(block.Hexstr2Address("0x9236B49DA606d83b3c69004D13fd14f9F545A90B"), big.NewInt(value))
 	assert.NoError(t, err)
-	return client.NewEthClient(c, c)
+	node.Mine()
+	return hash
 }
 
 func Test_Eth_GetNumber(t *testing.T) {
-	provider := initArbTracker(t)
+	node, provider, _ := initEthTracker(t)
+	node.MineN(3)
 	number, err := provider.BlockNumber(context.Background())
 	assert.NoError(t, err)
-	t.Log("number:", number)
+	assert.Equal(t, uint64(3), number)
 }
 
 func Test_Eth_ChainID(t *testing.T) {
-	provider := initArbTracker(t)
+	_, provider, _ := initEthTracker(t)
 	chainID, err := provider.ChainID(context.Background())
 	assert.NoError(t, err)
-	t.Log("chainID", chainID)
+	assert.Equal(t, int64(fakenode.DefaultChainID), chainID.Int64())
 }
 
 func Test_Eth_GetBlock(t *testing.T) {
-	provider := initEthTracker(t)
+	node, provider, key := initEthTracker(t)
+	hash := sendNative(t, node, provider, key, 1)
 	number, err := provider.BlockNumber(context.Background())
 	assert.NoError(t, err)
 	blockData, err := provider.BlockByNumber(context.Background(), number, true)
 	assert.NoError(t, err)
-	for _, tx := range blockData.Transactions {
-		t.Log("idx", tx.TransactionIndex, "hash", tx.Hash)
-	}
+	assert.Len(t, blockData.Transactions, 1)
+	assert.Equal(t, *hash, blockData.Transactions[0].Hash)
 }
 
 func Test_Eth_GetBlocks(t *testing.T) {
-	provider := initEthTracker(t)
-	blocks, err := provider.BlocksByNumbers(context.Background(), []uint64{15422138, 15422137}, true)
+	node, provider, key := initEthTracker(t)
+	sendNative(t, node, provider, key, 1)
+	sendNative(t, node, provider, key, 2)
+	blocks, err := provider.BlocksByNumbers(context.Background(), []uint64{2, 1}, true)
 	assert.NoError(t, err)
-	for _, blockData := range blocks {
-		t.Log("block number", blockData.Number)
-		for _, tx := range blockData.Transactions {
-			t.Log("tx_idx", tx.TransactionIndex, "tx_hash", tx.Hash)
-		}
+	assert.Len(t, blocks, 2)
+	for idx, number := range []uint64{2, 1} {
+		assert.Equal(t, number, uint64(blocks[idx].Number))
+		assert.Len(t, blocks[idx].Transactions, 1)
 	}
 }
 
 func Test_Eth_GetBlockByHash(t *testing.T) {
-	provider := initEthTracker(t)
-	blockData, err := provider.BlockByHash(context.Background(), block.Hex2Hash("0x5d257d69c5b97be15e4aad5ef86e173ea6fc9d16adc5f0fb71f8648e7522c52d"), true)
+	node, provider, key := initEthTracker(t)
+	sendNative(t, node, provider, key, 1)
+	mined := node.BlockByNumber(1)
+	blockData, err := provider.BlockByHash(context.Background(), block.Hex2Hash(mined.Hash().Hex()), true)
 	assert.NoError(t, err)
-	t.Log("tx count", len(blockData.Transactions))
-	for _, tx := range blockData.Transactions {
-		t.Log("tx_idx", tx.TransactionIndex, "tx_hash", tx.Hash)
-	}
+	assert.Equal(t, uint64(1), uint64(blockData.Number))
+	assert.Len(t, blockData.Transactions, 1)
 }
 
 func Test_eth_internal_Txs(t *testing.T) {
-	provider := initEthInternalTracker(t)
-	txHashes := []block.Hash{
-		block.Hex2Hash("0x48366dce1034414f5fe7b180140d8a78d9d7d83b10774b2901c705191050fd4f"),
-		block.Hex2Hash("0x8d8a524da2e9cb686b9d5f7c47af74908238303cea42149b2e316ccc72743ac4"),
-	}
+	node, provider, key := initEthTracker(t)
+	txHashes := []block.Hash{*sendNative(t, node, provider, key, 7), *sendNative(t, node, provider, key, 8)}
 	txs, err := provider.InternalTxs(context.Background(), txHashes, client.ErigonType)
 	assert.NoError(t, err)
-	t.Log("txs", txs)
-	for txHash := range txs {
-		fmt.Println("tx_hash", txHash)
-		for _, internalTx := range txs[txHash] {
-			t.Log("From", internalTx.From, "to", internalTx.To, "contract_address", internalTx.ContractAddress, "value", internalTx.Value, "blockNumber", internalTx.BlockNumber)
-		}
+	for idx, txHash := range txHashes {
+		assert.Len(t, txs[txHash.String()], 1)
+		internalTx := txs[txHash.String()][0]
+		assert.Equal(t, int64(7+idx), internalTx.Value.ToBigInt().Int64())
+		assert.Equal(t, uint64(idx+1), internalTx.BlockNumber)
 	}
-
 }
@@ -1,3 +1,6 @@
+//go:build live
+
+// 需要真实的测试网节点及账户，使用 go test -tags live ./tests/wallets 运行
 package wallets
 
 import (
@@ -9,8 +12,13 @@ import (
 	"testing"
 )
 
+// initProvider 连接 WALLET_RPC_URL 指定的测试网节点，未设置时跳过
 func initProvider(t *testing.T) client.Provider {
-	opts := jsonrpc2.GetDefaultOpts("https://goerli.infura.io/v3/fa57784b5b834db1b685341ec9867a3a")
+	endpoint := os.Getenv("WALLET_RPC_URL")
+	if endpoint == "" {
+		t.Skip("WALLET_RPC_URL is not set")
+	}
+	opts := jsonrpc2.GetDefaultOpts(endpoint)
 	c, err := jsonrpc2.NewClient(opts...)
 	assert.NoError(t, err)
 	return client.NewEthClient(c, nil)
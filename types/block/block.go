@@ -1,6 +1,7 @@
 package block
 
 import (
+	"encoding/json"
 	"github.com/ethereum/go-ethereum/common/math"
 )
 
@@ -18,7 +19,60 @@ type Block struct {
 	GasLimit           math.HexOrDecimal64
 	GasUsed            math.HexOrDecimal64
 	Timestamp          math.HexOrDecimal64
+	BaseFeePerGas      *BigInt
 	Transactions       []*Transaction
 	TransactionsHashes []Hash
 	Uncles             []Hash
 }
+
+// UnmarshalJSON transactions 可能是完整交易，也可能只是交易hash
+func (b *Block) UnmarshalJSON(data []byte) error {
+	type plain Block
+	aux := struct {
+		*plain
+		Transactions []json.RawMessage `json:"transactions"`
+	}{plain: (*plain)(b)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	b.Transactions = nil
+	b.TransactionsHashes = make([]Hash, 0, len(aux.Transactions))
+	for _, raw := range aux.Transactions {
+		if len(raw) > 0 && raw[0] == '"' {
+			var hash Hash
+			if err := json.Unmarshal(raw, &hash); err != nil {
+				return err
+			}
+			b.TransactionsHashes = append(b.TransactionsHashes, hash)
+			continue
+		}
+		tx := new(Transaction)
+		if err := json.Unmarshal(raw, tx); err != nil {
+			return err
+		}
+		b.Transactions = append(b.Transactions, tx)
+		b.TransactionsHashes = append(b.TransactionsHashes, tx.Hash)
+	}
+	return nil
+}
+
+// Copy 复制区块及其交易，修改副本的字段或切片不影响原区块，字节内容与原区块共享
+func (b *Block) Copy() *Block {
+	if b == nil {
+		return nil
+	}
+	cpy := *b
+	if b.Transactions != nil {
+		cpy.Transactions = make([]*Transaction, len(b.Transactions))
+		for i, tx := range b.Transactions {
+			cpy.Transactions[i] = tx.Copy()
+		}
+	}
+	if b.TransactionsHashes != nil {
+		cpy.TransactionsHashes = append([]Hash(nil), b.TransactionsHashes...)
+	}
+	if b.Uncles != nil {
+		cpy.Uncles = append([]Hash(nil), b.Uncles...)
+	}
+	return &cpy
+}
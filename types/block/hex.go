@@ -46,6 +46,10 @@ func (h *Hex) ToHex(value any) (err error) {
 		return
 	case string:
 		if len(v) > 2 {
+			// r、s 等字段节点按quantity编码，可能去掉了前导0
+			if len(v)%2 == 1 {
+				v = v[:2] + "0" + v[2:]
+			}
 			*h, err = hexutil.Decode(v)
 		}
 		return
@@ -0,0 +1,34 @@
+package block
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHex_ToHex(t *testing.T) {
+	cases := map[string][]byte{
+		"0x":       nil,
+		"0x1":      {0x01},
+		"0x0102":   {0x01, 0x02},
+		"0x10203":  {0x01, 0x02, 0x03},
+		"0xabcdef": {0xab, 0xcd, 0xef},
+	}
+	for value, want := range cases {
+		var h Hex
+		assert.NoError(t, h.ToHex(value), value)
+		assert.Equal(t, want, h.Bytes(), value)
+	}
+
+	var h Hex
+	assert.Error(t, h.ToHex("0xzz"))
+	assert.Error(t, h.ToHex(1))
+}
+
+func TestTransaction_oddSignature(t *testing.T) {
+	// 节点按quantity编码r、s，去掉了前导0
+	var tx Transaction
+	assert.NoError(t, json.Unmarshal([]byte(`{"r":"0xabc","s":"0x1"}`), &tx))
+	assert.Equal(t, []byte{0x0a, 0xbc}, tx.R.Bytes())
+	assert.Equal(t, []byte{0x01}, tx.S.Bytes())
+}
@@ -1,10 +1,87 @@
 package block
 
+import "math/big"
+
+// InternalTxCallTrace 调用树中的一个调用，按深度优先的顺序排列
+// selfdestruct 时 From 为销毁的合约，To 为接收余额的地址，Value 为退回的余额
 type InternalTxCallTrace struct {
 	From            Hex
 	To              Hex
 	ContractAddress Hex
 	Value           BigInt
 	TxHash          Hex
+	BlockHash       Hex
 	BlockNumber     uint64
+	// CallType call、staticcall、delegatecall、callcode、create、create2、selfdestruct
+	CallType string
+	// TraceAddress 在调用树中的路径，顶层调用为空，[0 1] 表示顶层调用的第1个子调用的第2个子调用
+	TraceAddress []int
+	// Depth 调用深度，顶层调用为0
+	Depth   int
+	Gas     uint64
+	GasUsed uint64
+	// Input 调用的calldata，create时为合约的初始化代码
+	Input Hex
+	// Output 调用的返回值，create时为部署的合约代码，revert时为revert数据
+	Output Hex
+	// Error 调用失败的原因，为空表示调用成功
+	Error string
+	// RevertReason 从revert数据中解析出的原因
+	RevertReason string
+	// Reverted 调用自身或者上层调用失败，状态变更及转账都已回滚
+	Reverted bool
+}
+
+// IsCreate 是否为合约创建
+func (t *InternalTxCallTrace) IsCreate() bool {
+	return t.CallType == "create" || t.CallType == "create2"
+}
+
+// TraceFilter 返回true时保留
+type TraceFilter func(trace *InternalTxCallTrace) bool
+
+// ValueTransfers 实际发生的原生币转移，包括带value的调用、合约创建及自毁，delegatecall 的value属于上层调用不计入
+func ValueTransfers(trace *InternalTxCallTrace) bool {
+	value := big.Int(trace.Value)
+	return !trace.Reverted && trace.CallType != "delegatecall" && value.Sign() > 0
+}
+
+// Creations 成功的合约创建
+func Creations(trace *InternalTxCallTrace) bool {
+	return !trace.Reverted && trace.IsCreate()
+}
+
+// Succeeded 未回滚的调用
+func Succeeded(trace *InternalTxCallTrace) bool {
+	return !trace.Reverted
+}
+
+// AnyOf 满足任一条件即保留
+func AnyOf(filters ...TraceFilter) TraceFilter {
+	return func(trace *InternalTxCallTrace) bool {
+		for _, filter := range filters {
+			if filter(trace) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterTraces 保留满足所有条件的调用，不修改原切片
+func FilterTraces(traces []*InternalTxCallTrace, filters ...TraceFilter) []*InternalTxCallTrace {
+	result := make([]*InternalTxCallTrace, 0, len(traces))
+	for _, trace := range traces {
+		keep := true
+		for _, filter := range filters {
+			if !filter(trace) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, trace)
+		}
+	}
+	return result
 }
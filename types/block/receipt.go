@@ -15,3 +15,19 @@ type Receipt struct {
 	Logs              []*Log
 	Status            math.HexOrDecimal64
 }
+
+// Copy 复制回执及其日志
+func (r *Receipt) Copy() *Receipt {
+	if r == nil {
+		return nil
+	}
+	cpy := *r
+	if r.Logs != nil {
+		cpy.Logs = make([]*Log, len(r.Logs))
+		for i, l := range r.Logs {
+			log := *l
+			cpy.Logs[i] = &log
+		}
+	}
+	return &cpy
+}
@@ -38,3 +38,20 @@ type Transaction struct {
 	Receipt            *Receipt
 	InternalTraceCalls []*InternalTxCallTrace
 }
+
+// Copy 复制交易及其回执、内部交易，字节内容与原交易共享
+func (tx *Transaction) Copy() *Transaction {
+	if tx == nil {
+		return nil
+	}
+	cpy := *tx
+	cpy.Receipt = tx.Receipt.Copy()
+	if tx.InternalTraceCalls != nil {
+		cpy.InternalTraceCalls = make([]*InternalTxCallTrace, len(tx.InternalTraceCalls))
+		for i, trace := range tx.InternalTraceCalls {
+			t := *trace
+			cpy.InternalTraceCalls[i] = &t
+		}
+	}
+	return &cpy
+}
@@ -11,14 +11,21 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/taorzhang/toolkit/abi"
 	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/errs"
 	"github.com/taorzhang/toolkit/types/block"
 	"github.com/tyler-smith/go-bip39"
 	"math/big"
+	"sync"
 )
 
 type Account struct {
 	PrivateKey *ecdsa.PrivateKey
 	Client     client.Provider
+	mu         sync.Mutex
+	// chain 链的元数据，为空时按节点的链id从注册表中查找
+	chain *client.Chain
+	// chainVerified chain的链id已与节点校验
+	chainVerified bool
 }
 
 func NewWalletFromPrivateKeyStr(privateKeyString string, options ...Option) *Account {
@@ -102,7 +109,7 @@ func (w *Account) DeployContractByCreate2(code string) (*block.Hash, error) {
 
 // SendNativeToken 发送原生代币
 func (w *Account) SendNativeToken(to block.Address, amount *big.Int) (*block.Hash, error) {
-	txData, err := w.CreateLegacyTxData(Pending, to, amount, nil)
+	txData, err := w.CreateTxData(Pending, to, amount, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +139,7 @@ func (w *Account) SendErc20Token(contract block.Address, to block.Address, amoun
 	if err != nil {
 		return nil, err
 	}
-	txData, err := w.CreateLegacyTxData(Pending, contract, big.NewInt(0), method, to.String(), tokenNum.String())
+	txData, err := w.CreateTxData(Pending, contract, big.NewInt(0), method, to.String(), tokenNum.String())
 	//txData, err := w.Create1559TxData(Pending, contract, big.NewInt(0), method, to.String(), tokenNum.String())
 	if err != nil {
 		return nil, err
@@ -162,7 +169,7 @@ func (w *Account) MintErc20Token(contract block.Address, amount string) (*block.
 	if err != nil {
 		return nil, err
 	}
-	txData, err := w.CreateLegacyTxData(Pending, contract, big.NewInt(0), method, tokenNum.String())
+	txData, err := w.CreateTxData(Pending, contract, big.NewInt(0), method, tokenNum.String())
 	//txData, err := w.Create1559TxData(Pending, contract, big.NewInt(0), method, to.String(), tokenNum.String())
 	if err != nil {
 		return nil, err
@@ -193,7 +200,7 @@ func (w *Account) ApprovalErc20Token(contract block.Address, to block.Address, a
 	if err != nil {
 		return nil, err
 	}
-	txData, err := w.CreateLegacyTxData(Pending, contract, big.NewInt(0), method, to.String(), tokenNum.String())
+	txData, err := w.CreateTxData(Pending, contract, big.NewInt(0), method, to.String(), tokenNum.String())
 	if err != nil {
 		return nil, err
 	}
@@ -247,7 +254,7 @@ func (w *Account) TransferFromErc20Token(contract block.Address, from block.Addr
 	if allowanceNum.Cmp(tokenNum) < 0 {
 		return nil, fmt.Errorf("allowance token number %s, and transfer token number %s", allowanceNum.String(), tokenNum.String())
 	}
-	txData, err := w.CreateLegacyTxData(Pending, contract, big.NewInt(0), method, from.String(), to.String(), tokenNum.String())
+	txData, err := w.CreateTxData(Pending, contract, big.NewInt(0), method, from.String(), to.String(), tokenNum.String())
 	if err != nil {
 		return nil, err
 	}
@@ -274,7 +281,7 @@ func (w *Account) SendErc721(contract block.Address, to block.Address, tokenID *
 	if err != nil {
 		return nil, err
 	}
-	data, err := w.CreateLegacyTxData(Pending, contract, big.NewInt(0), method, w.Address(), to.String(), tokenID)
+	data, err := w.CreateTxData(Pending, contract, big.NewInt(0), method, w.Address(), to.String(), tokenID)
 	if err != nil {
 		return nil, err
 	}
@@ -297,12 +304,12 @@ func (w *Account) PartialFailure(contract block.Address, to block.Address) (*blo
 		return nil, err
 	}
 
-	toWei, err := ToWei("0.2")
+	toWei, err := w.ToNative("0.2")
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := w.CreateLegacyTxData(Pending, contract, toWei, method, to.String())
+	data, err := w.CreateTxData(Pending, contract, toWei, method, to.String())
 	if err != nil {
 		return nil, err
 	}
@@ -358,9 +365,61 @@ func (w *Account) ApprovalErc1155(contract block.Address, tokenID *big.Int) {
 
 }
 
+// Chain 账户所在链的元数据，WithChain 指定的链id与节点不一致时返回 errs.ChainIDMismatch
+// 没有指定时按节点的链id查找一次并保存
+func (w *Account) Chain() (client.Chain, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.chain == nil {
+		chain, err := client.ChainOf(context.Background(), w.Client)
+		if err != nil {
+			return client.Chain{}, err
+		}
+		w.chain, w.chainVerified = &chain, true
+		return chain, nil
+	}
+	if err := w.verifyChain(); err != nil {
+		return client.Chain{}, err
+	}
+	return *w.chain, nil
+}
+
+// verifyChain 指定的链id只与节点校验一次，校验失败下次重新校验，没有节点时不校验，调用方需持有mu
+func (w *Account) verifyChain() error {
+	if w.Client == nil || w.chainVerified {
+		return nil
+	}
+	id, err := w.Client.ChainID(context.Background())
+	if err != nil {
+		return err
+	}
+	if id.Uint64() != w.chain.ID {
+		return errs.New(errs.ChainIDMismatch, fmt.Sprintf("node chain id is %d, wallet chain %s is %d", id.Uint64(), w.chain.Name, w.chain.ID))
+	}
+	w.chainVerified = true
+	return nil
+}
+
+// ToNative 按原生币精度转换数量，如 ETH 转换为 wei
+func (w *Account) ToNative(amount string) (*big.Int, error) {
+	chain, err := w.Chain()
+	if err != nil {
+		return nil, err
+	}
+	return DataMulDecimal(amount, chain.NativeDecimals)
+}
+
+func (w *Account) chainID() (*big.Int, error) {
+	chain, err := w.Chain()
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(chain.ID), nil
+}
+
 // SignTx 对交易进行签名
 func (w *Account) SignTx(tx types.TxData) (string, error) {
-	chainID, err := w.Client.ChainID(context.Background())
+	chainID, err := w.chainID()
 	if err != nil {
 		return "", err
 	}
@@ -442,6 +501,18 @@ func (w *Account) CreateLegacyTxData(nonceStatus NonceStatus, to block.Address,
 	return txData, nil
 }
 
+// CreateTxData 按链是否支持EIP-1559创建动态手续费交易或者legacy交易
+func (w *Account) CreateTxData(nonceStatus NonceStatus, to block.Address, amount *big.Int, method *abi.Method, args ...interface{}) (types.TxData, error) {
+	chain, err := w.Chain()
+	if err != nil {
+		return nil, err
+	}
+	if chain.EIP1559 {
+		return w.Create1559TxData(nonceStatus, to, amount, method, args...)
+	}
+	return w.CreateLegacyTxData(nonceStatus, to, amount, method, args...)
+}
+
 func (w *Account) Create1559TxData(
 	nonceStatus NonceStatus,
 	to block.Address,
@@ -452,7 +523,7 @@ func (w *Account) Create1559TxData(
 	if err != nil {
 		return nil, err
 	}
-	chainID, err := w.Client.ChainID(context.Background())
+	chainID, err := w.chainID()
 	if err != nil {
 		return nil, err
 	}
@@ -468,6 +539,15 @@ func (w *Account) Create1559TxData(
 	if err != nil {
 		return nil, err
 	}
+	// gasPrice 约为 baseFee + tip，预留两倍应对baseFee上涨
+	gasPrice, err := w.Client.GetGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	gasFeeCap := new(big.Int).Mul(gasPrice, big.NewInt(2))
+	if gasFeeCap.Cmp(gasTipCap) < 0 {
+		gasFeeCap.Set(gasTipCap)
+	}
 	txData := &types.DynamicFeeTx{
 		ChainID: chainID,
 		Nonce:   nonce,
@@ -476,7 +556,7 @@ func (w *Account) Create1559TxData(
 		// (Max Priority Fee) 最高优先费用，直接支付给矿工
 		GasTipCap: gasTipCap,
 		// （Max Fee Per Gas） 每单位gas的最高费用
-		GasFeeCap: gasTipCap.Mul(gasTipCap, big.NewInt(2)),
+		GasFeeCap: gasFeeCap,
 		Data:      common.FromHex(encode),
 	}
 	gas, err := w.EstimateGas(types.NewTx(txData))
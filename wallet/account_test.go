@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/taorzhang/toolkit/client"
+	"github.com/taorzhang/toolkit/client/fakenode"
+	"github.com/taorzhang/toolkit/client/jsonrpc"
+	"github.com/taorzhang/toolkit/errs"
+	"github.com/taorzhang/toolkit/types/block"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+type chainIDCounter struct {
+	client.Provider
+	calls uint64
+}
+
+func (p *chainIDCounter) ChainID(ctx context.Context) (*big.Int, error) {
+	atomic.AddUint64(&p.calls, 1)
+	return p.Provider.ChainID(ctx)
+}
+
+func newTestAccount(t *testing.T, options ...Option) (*Account, *chainIDCounter) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	node, err := fakenode.New(fakenode.WithAlloc(map[common.Address]*big.Int{crypto.PubkeyToAddress(key.PublicKey): big.NewInt(1e18)}))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = node.Close() })
+	rpcClient, err := jsonrpc.NewClient(jsonrpc.GetDefaultOpts(node.URL())...)
+	assert.NoError(t, err)
+	t.Cleanup(rpcClient.Release)
+	provider := &chainIDCounter{Provider: client.NewEthClient(rpcClient, rpcClient)}
+	account := &Account{PrivateKey: key}
+	for _, opt := range append([]Option{WithEthProvider(provider)}, options...) {
+		opt(account)
+	}
+	return account, provider
+}
+
+func TestAccount_withChain(t *testing.T) {
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000aa")
+	// 链id为0时忽略，使用节点的链id
+	account, _ := newTestAccount(t, WithChain(client.Chain{Name: "unknown"}))
+	chain, err := account.Chain()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(fakenode.DefaultChainID), chain.ID)
+
+	// 指定的链id与节点不一致时拒绝签名
+	account, _ = newTestAccount(t, WithChain(client.Chain{ID: 1, Name: "ethereum", EIP1559: true}))
+	_, err = account.SendNativeToken(to, big.NewInt(1))
+	assert.ErrorIs(t, err, errs.ChainIDMismatch)
+
+	// 一致时只校验一次
+	account, provider := newTestAccount(t, WithChain(client.Chain{ID: fakenode.DefaultChainID, Name: "dev", EIP1559: true}))
+	for i := 0; i < 2; i++ {
+		_, err = account.SendNativeToken(to, big.NewInt(1))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&provider.calls))
+}
+
+func TestAccount_chainOnce(t *testing.T) {
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000aa")
+	// 没有指定链时只向节点查询一次
+	account, provider := newTestAccount(t)
+	for i := 0; i < 2; i++ {
+		_, err := account.SendNativeToken(to, big.NewInt(1))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&provider.calls))
+}
+
+func TestAccount_CreateTxData(t *testing.T) {
+	to := block.Hexstr2Address("0x00000000000000000000000000000000000000bb")
+	account, _ := newTestAccount(t)
+	txData, err := account.CreateTxData(Pending, to, big.NewInt(1), nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &types.DynamicFeeTx{}, txData)
+
+	account, _ = newTestAccount(t, WithChain(client.Chain{ID: fakenode.DefaultChainID, Name: "legacy"}))
+	txData, err = account.CreateTxData(Pending, to, big.NewInt(1), nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &types.LegacyTx{}, txData)
+}
@@ -1,9 +1,21 @@
 package wallet
 
-import "github.com/taorzhang/toolkit/client"
+import (
+	"github.com/taorzhang/toolkit/client"
+)
 
 type Option func(wallet *Account)
 
+// WithChain 指定链的元数据，签名时使用其中的链id，首次使用时与节点返回的链id校验一次
+// 链id为0时忽略，按节点的链id从注册表中查找
+func WithChain(chain client.Chain) Option {
+	return func(wallet *Account) {
+		if chain.ID != 0 {
+			wallet.chain = &chain
+		}
+	}
+}
+
 func WithEthProvider(client client.Provider) Option {
 	return func(wallet *Account) {
 		wallet.Client = client